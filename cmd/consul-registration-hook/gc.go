@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/allegro/consul-registration-hook/consul"
+	"github.com/allegro/consul-registration-hook/k8s"
+	"github.com/urfave/cli"
+)
+
+const (
+	flagNodeName   = "node-name"
+	envVarNodeName = "KUBERNETES_NODE_NAME"
+
+	flagMinOrphanAge    = "min-orphan-age"
+	envVarMinOrphanAge  = "HOOK_MIN_ORPHAN_AGE"
+	defaultMinOrphanAge = time.Minute
+)
+
+var minOrphanAgeFlag = cli.DurationFlag{
+	Name:   flagMinOrphanAge,
+	Usage:  "deregister only services that are still orphaned after given time",
+	EnvVar: envVarMinOrphanAge,
+	Value:  defaultMinOrphanAge,
+}
+
+var gcCommand = cli.Command{
+	Name: "gc",
+	Usage: "Deregister services left in local Consul agent by instances that no longer run.\n\n" +
+		"Services are deregistered only when they are still orphaned after --min-orphan-age.",
+	Subcommands: []cli.Command{
+		{
+			Name:  "mesos",
+			Usage: "Deregister services of tasks that no longer run on the agent using data from Mesos Agent API",
+			Action: func(c *cli.Context) error {
+				configureLogger(c)
+				provider := mesosServiceProvider(c)
+				agent, err := newAgent(c)
+				if err != nil {
+					return err
+				}
+				defer closeAgent(agent)
+				return collectGarbage(c, agent, agent.Services, func(services []consul.ServiceInstance) ([]consul.ServiceInstance, error) {
+					return provider.FindOrphans(context.Background(), services)
+				})
+			},
+			Flags: append([]cli.Flag{minOrphanAgeFlag, dryRunFlag}, mesosFlags...),
+		},
+		{
+			Name:  "k8s",
+			Usage: "Deregister services of pods that no longer run on the node using data from Kubernetes API",
+			Action: func(c *cli.Context) error {
+				configureLogger(c)
+				nodeName := c.String(flagNodeName)
+				if nodeName == "" {
+					return errors.New("missing node name")
+				}
+				provider := k8s.ServiceProvider{}
+				agent, err := newAgent(c)
+				if err != nil {
+					return err
+				}
+				defer closeAgent(agent)
+				// Services of pods from other Kubernetes namespaces are
+				// registered in mapped Consul namespaces.
+				listServices := agent.Services
+				if namespaceMappingEnabled(c) {
+					listServices = agent.ServicesInAllNamespaces
+				}
+				return collectGarbage(c, agent, listServices, func(services []consul.ServiceInstance) ([]consul.ServiceInstance, error) {
+					return provider.FindOrphans(context.Background(), nodeName, services)
+				})
+			},
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:   flagNodeName,
+					Usage:  "name of the node local Consul agent runs on",
+					EnvVar: envVarNodeName,
+				},
+				minOrphanAgeFlag,
+				dryRunFlag,
+			},
+		},
+	},
+}
+
+// collectGarbage deregisters services of local Consul agent found orphaned
+// twice, before and after the minimal orphan age passes. In dry-run mode
+// orphans found initially are printed without waiting.
+func collectGarbage(c *cli.Context, agent *consul.Agent, listServices serviceLister, findOrphans func([]consul.ServiceInstance) ([]consul.ServiceInstance, error)) error {
+	orphans, err := findAgentOrphans(listServices, findOrphans)
+	if err != nil {
+		return err
+	}
+	log.Printf("Found %d orphaned services", len(orphans))
+
+	if minAge := c.Duration(flagMinOrphanAge); minAge > 0 && len(orphans) > 0 && !c.Bool(flagDryRun) {
+		log.Printf("Waiting %s to confirm services are orphaned", minAge)
+		time.Sleep(minAge)
+
+		confirmed, err := findAgentOrphans(listServices, findOrphans)
+		if err != nil {
+			return err
+		}
+		orphans = intersectServices(orphans, confirmed)
+		log.Printf("Confirmed %d orphaned services", len(orphans))
+	}
+
+	for _, orphan := range orphans {
+		log.Printf("Service %q (%s at %s:%d) is orphaned", orphan.ID, orphan.Name, orphan.Host, orphan.Port)
+	}
+	return agent.Deregister(orphans)
+}
+
+// serviceLister returns services registered in local Consul agent.
+type serviceLister func() ([]consul.ServiceInstance, error)
+
+func findAgentOrphans(listServices serviceLister, findOrphans func([]consul.ServiceInstance) ([]consul.ServiceInstance, error)) ([]consul.ServiceInstance, error) {
+	services, err := listServices()
+	if err != nil {
+		return nil, err
+	}
+	orphans, err := findOrphans(services)
+	if err != nil {
+		return nil, fmt.Errorf("error finding orphaned services: %s", err)
+	}
+	return orphans, nil
+}
+
+func intersectServices(a, b []consul.ServiceInstance) []consul.ServiceInstance {
+	ids := make(map[string]bool, len(b))
+	for _, service := range b {
+		ids[service.Namespace+"/"+service.ID] = true
+	}
+	var result []consul.ServiceInstance
+	for _, service := range a {
+		if ids[service.Namespace+"/"+service.ID] {
+			result = append(result, service)
+		}
+	}
+	return result
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -31,9 +32,43 @@ const (
 	flagCheckPath   = "check-path"
 	envVarCheckPath = "KUBERNETES_CHECK_PATH"
 
+	flagCheckType   = "check-type"
+	envVarCheckType = "KUBERNETES_CHECK_TYPE"
+
+	flagCheckInterval    = "check-interval"
+	envVarCheckInterval  = "KUBERNETES_CHECK_INTERVAL"
+	defaultCheckInterval = 30 * time.Second
+
+	flagCheckTimeout    = "check-timeout"
+	envVarCheckTimeout  = "KUBERNETES_CHECK_TIMEOUT"
+	defaultCheckTimeout = 30 * time.Second
+
+	flagCheckMethod   = "check-method"
+	envVarCheckMethod = "KUBERNETES_CHECK_METHOD"
+
+	flagCheckHeader = "check-header"
+
+	flagCheckTLSSkipVerify   = "check-tls-skip-verify"
+	envVarCheckTLSSkipVerify = "KUBERNETES_CHECK_TLS_SKIP_VERIFY"
+
+	flagCheckDeregisterAfter   = "check-deregister-after"
+	envVarCheckDeregisterAfter = "KUBERNETES_CHECK_DEREGISTER_AFTER"
+
+	flagConnectNative   = "connect-native"
+	envVarConnectNative = "CONSUL_CONNECT_NATIVE"
+
+	flagServiceConfig   = "config"
+	envVarServiceConfig = "CONSUL_SERVICE_CONFIG"
+
 	flagServiceID = "service-id"
 	envServiceID  = "KUBERNETES_SERVICE_ID"
 
+	flagMatchName    = "match-name"
+	flagMatchTag     = "match-tag"
+	flagMatchAddress = "match-address"
+	flagMatchPort    = "match-port"
+	flagAllMatching  = "all-matching"
+
 	flagGetPodTimeout    = "get-pod-timeout"
 	envVarGetPodTimeout  = "KUBERNETES_GET_POD_TIMEOUT"
 	defaultGetPodTimeout = 10 * time.Second
@@ -42,8 +77,233 @@ const (
 	flagHealthCheckTimeout    = "health-check-timeout"
 	envVarHealthCheckTimeout  = "KUBERNETES_HEALTH_CHECK_TIMEOUT"
 	defaultHealthCheckTimeout = 300 * time.Second
+
+	flagDrainTime   = "drain-time"
+	envVarDrainTime = "CONSUL_DRAIN_TIME"
+
+	flagConsulAddr          = "consul-addr"
+	flagConsulCAFile        = "consul-ca-file"
+	flagConsulClientCert    = "consul-client-cert"
+	flagConsulClientKey     = "consul-client-key"
+	flagConsulTLSServerName = "consul-tls-server-name"
+
+	flagConsulNamespace   = "consul-namespace"
+	envVarConsulNamespace = "CONSUL_NAMESPACE"
+
+	flagConsulPartition   = "consul-partition"
+	envVarConsulPartition = "CONSUL_PARTITION"
+
+	flagConsulNamespaceMirroring       = "consul-k8s-namespace-mirroring"
+	flagConsulNamespaceMirroringPrefix = "consul-k8s-namespace-mirroring-prefix"
+	flagConsulNamespaceMapFile         = "consul-k8s-namespace-map-file"
+
+	flagConsulKeepExistingChecks   = "consul-keep-existing-checks"
+	envVarConsulKeepExistingChecks = "CONSUL_KEEP_EXISTING_CHECKS"
+
+	flagConsulCheckToken   = "consul-check-token"
+	envVarConsulCheckToken = "CONSUL_CHECK_TOKEN"
+
+	flagConsulLoginMethod   = "consul-login-method"
+	envVarConsulLoginMethod = "CONSUL_LOGIN_METHOD"
+
+	flagConsulLoginNamespace   = "consul-login-namespace"
+	envVarConsulLoginNamespace = "CONSUL_LOGIN_NAMESPACE"
+
+	flagConsulLoginBearerTokenFile   = "consul-login-bearer-token-file"
+	envVarConsulLoginBearerTokenFile = "CONSUL_LOGIN_BEARER_TOKEN_FILE"
+
+	flagConsulLoginTokenFile   = "consul-login-token-file"
+	envVarConsulLoginTokenFile = "CONSUL_LOGIN_TOKEN_FILE"
+
+	flagDryRun   = "dry-run"
+	envVarDryRun = "HOOK_DRY_RUN"
+
+	flagMesosAgentURL   = "mesos-agent-url"
+	envVarMesosAgentURL = "MESOS_AGENT_URL"
+
+	flagMesosAgentCAFile   = "mesos-agent-ca-file"
+	envVarMesosAgentCAFile = "MESOS_AGENT_CA_FILE"
+
+	flagMesosAgentPrincipal   = "mesos-agent-principal"
+	envVarMesosAgentPrincipal = "MESOS_AGENT_PRINCIPAL"
+
+	flagMesosAgentSecret   = "mesos-agent-secret"
+	envVarMesosAgentSecret = "MESOS_AGENT_SECRET"
+
+	flagMesosAgentTokenFile   = "mesos-agent-token-file"
+	envVarMesosAgentTokenFile = "MESOS_AGENT_TOKEN_FILE"
+
+	flagMesosAgentTimeout    = "mesos-agent-timeout"
+	envVarMesosAgentTimeout  = "MESOS_AGENT_TIMEOUT"
+	defaultMesosAgentTimeout = 10 * time.Second
+
+	flagMesosAgentAPI   = "mesos-agent-api"
+	envVarMesosAgentAPI = "MESOS_AGENT_API"
+
+	flagMesosNetwork   = "mesos-network"
+	envVarMesosNetwork = "MESOS_NETWORK_MODE"
+
+	flagWANAddressNodeAnnotation   = "wan-address-node-annotation"
+	envVarWANAddressNodeAnnotation = "KUBERNETES_WAN_ADDRESS_NODE_ANNOTATION"
+
+	flagWANAddressNodeExternalIP   = "wan-address-node-external-ip"
+	envVarWANAddressNodeExternalIP = "KUBERNETES_WAN_ADDRESS_NODE_EXTERNAL_IP"
 )
 
+var wanAddressFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:   flagWANAddressNodeAnnotation,
+		Usage:  "node annotation holding WAN address registered as wan tagged address of services",
+		EnvVar: envVarWANAddressNodeAnnotation,
+	},
+	cli.BoolFlag{
+		Name:   flagWANAddressNodeExternalIP,
+		Usage:  "register node external IP as wan tagged address of services, when node annotation is not set",
+		EnvVar: envVarWANAddressNodeExternalIP,
+	},
+}
+
+func wanAddress(c *cli.Context) k8s.WANAddress {
+	return k8s.WANAddress{
+		NodeAnnotation: c.String(flagWANAddressNodeAnnotation),
+		NodeExternalIP: c.Bool(flagWANAddressNodeExternalIP),
+	}
+}
+
+var mesosNetworkFlag = cli.StringFlag{
+	Name:   flagMesosNetwork,
+	Usage:  "address registered for Mesos tasks: host (agent hostname and host ports) or container (container IP and container ports)",
+	EnvVar: envVarMesosNetwork,
+	Value:  string(mesos.NetworkHost),
+}
+
+var mesosFlags = []cli.Flag{
+	mesosNetworkFlag,
+	cli.StringFlag{
+		Name:   flagMesosAgentURL,
+		Usage:  "Mesos agent URL (defaults to MESOS_AGENT_ENDPOINT or LIBPROCESS_IP of the executor, or localhost:5050, using https when CA file is set)",
+		EnvVar: envVarMesosAgentURL,
+	},
+	cli.StringFlag{
+		Name:   flagMesosAgentCAFile,
+		Usage:  "PEM encoded CA certificate used to verify HTTPS Mesos agent",
+		EnvVar: envVarMesosAgentCAFile,
+	},
+	cli.StringFlag{
+		Name:   flagMesosAgentPrincipal,
+		Usage:  "principal used for HTTP basic authentication in Mesos agent",
+		EnvVar: envVarMesosAgentPrincipal,
+	},
+	cli.StringFlag{
+		Name:   flagMesosAgentSecret,
+		Usage:  "secret used for HTTP basic authentication in Mesos agent",
+		EnvVar: envVarMesosAgentSecret,
+	},
+	cli.StringFlag{
+		Name:   flagMesosAgentTokenFile,
+		Usage:  "file with JWT sent as bearer token to Mesos agent, used instead of basic authentication",
+		EnvVar: envVarMesosAgentTokenFile,
+	},
+	cli.DurationFlag{
+		Name:   flagMesosAgentTimeout,
+		Usage:  "timeout of requests to Mesos agent",
+		EnvVar: envVarMesosAgentTimeout,
+		Value:  defaultMesosAgentTimeout,
+	},
+	cli.StringFlag{
+		Name:   flagMesosAgentAPI,
+		Usage:  "Mesos agent API used to read tasks: v1 (operator API, falls back to state when unsupported) or state",
+		EnvVar: envVarMesosAgentAPI,
+		Value:  string(mesos.AgentAPIV1),
+	},
+}
+
+var cliServiceFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:   flagServiceConfig,
+		Usage:  "service definition file (YAML or JSON, subset of Consul service definition format) used instead of other flags",
+		EnvVar: envVarServiceConfig,
+	},
+	cli.StringFlag{
+		Name:   flagServiceName,
+		Usage:  "service name to register by cli",
+		EnvVar: envVarServiceName,
+	},
+	cli.StringFlag{
+		Name:   flagPodIP,
+		Usage:  "pod ip to register in consul",
+		EnvVar: envVarPodIP,
+	},
+	cli.IntFlag{
+		Name:   flagContainerPort,
+		Usage:  "container port to register in consul",
+		EnvVar: envVarContainerPort,
+	},
+	cli.StringFlag{
+		Name:   flagServiceTags,
+		Usage:  "tags to register in consul (comma delimited values: k8sPodNamespace:default,scUid:sc-11298,default-monitoring)",
+		EnvVar: envVarServiceTags,
+	},
+	cli.StringFlag{
+		Name:   flagCheckPath,
+		Usage:  "health check to register in consul",
+		EnvVar: envVarCheckPath,
+	},
+	cli.StringFlag{
+		Name:   flagCheckType,
+		Usage:  "health check type: http, https, tcp, grpc, h2ping, ttl or none (defaults to http when check path is set, none otherwise)",
+		EnvVar: envVarCheckType,
+	},
+	cli.DurationFlag{
+		Name:   flagCheckInterval,
+		Usage:  "health check interval, or TTL for ttl checks",
+		EnvVar: envVarCheckInterval,
+		Value:  defaultCheckInterval,
+	},
+	cli.DurationFlag{
+		Name:   flagCheckTimeout,
+		Usage:  "health check timeout",
+		EnvVar: envVarCheckTimeout,
+		Value:  defaultCheckTimeout,
+	},
+	cli.StringFlag{
+		Name:   flagCheckMethod,
+		Usage:  "HTTP method used by http and https checks (defaults to GET)",
+		EnvVar: envVarCheckMethod,
+	},
+	cli.StringSliceFlag{
+		Name:  flagCheckHeader,
+		Usage: "HTTP header sent by http and https checks in \"Name: value\" format, can be repeated",
+	},
+	cli.BoolFlag{
+		Name:   flagCheckTLSSkipVerify,
+		Usage:  "skip certificate verification of https checks",
+		EnvVar: envVarCheckTLSSkipVerify,
+	},
+	cli.DurationFlag{
+		Name:   flagCheckDeregisterAfter,
+		Usage:  "deregister service after its check is critical for given time (defaults to 15m)",
+		EnvVar: envVarCheckDeregisterAfter,
+	},
+	cli.BoolFlag{
+		Name:   flagConnectNative,
+		Usage:  "register service as native Connect service, accepting Connect mTLS connections itself",
+		EnvVar: envVarConnectNative,
+	},
+}
+
+var drainTimeFlag = cli.DurationFlag{
+	Name:   flagDrainTime,
+	Usage:  "put services into Consul maintenance mode and wait given time before deregistering them (disabled when 0)",
+	EnvVar: envVarDrainTime,
+}
+
+var dryRunFlag = cli.BoolFlag{
+	Name:   flagDryRun,
+	Usage:  "print requests that would be sent to Consul agent as JSON instead of sending them",
+	EnvVar: envVarDryRun,
+}
+
 var commands = []cli.Command{
 	{
 		Name: "register",
@@ -56,29 +316,35 @@ var commands = []cli.Command{
 				Name:  "mesos",
 				Usage: "Register using data from Mesos Agent API",
 				Action: func(c *cli.Context) error {
-					logger.ConfigureLogger()
+					configureLogger(c)
 					log.Print("Registering services using data from Mesos API")
-					provider := mesos.ServiceProvider{}
-					// TODO(medzin): Add support for timeout here
+					provider := mesosServiceProvider(c)
 					services, err := provider.Get(context.Background())
 					if err != nil {
 						return fmt.Errorf("error getting services to register: %s", err)
 					}
 					log.Printf("Found %d services to register", len(services))
-					aclTokenFile := c.Parent().Parent().String(consulACLFileFlag)
-					agent := consul.NewAgent(aclTokenFile)
+					agent, err := newHookAgent(c)
+					if err != nil {
+						return err
+					}
+					if err := checkToken(c, agent, services); err != nil {
+						return err
+					}
 					return agent.Register(services)
 				},
+				Flags: append([]cli.Flag{dryRunFlag}, mesosFlags...),
 			},
 			{
 				Name:  "k8s",
 				Usage: "Register using data from Kubernetes API",
 				Action: func(c *cli.Context) error {
-					logger.ConfigureLogger()
+					configureLogger(c)
 					log.Print("Registering services using data from Kubernetes API")
 					provider := k8s.ServiceProvider{
 						Timeout:            c.Duration(flagGetPodTimeout),
 						HealthCheckTimeout: c.Duration(flagHealthCheckTimeout),
+						WANAddress:         wanAddress(c),
 					}
 					// TODO(medzin): Add support for timeout here
 					services, err := provider.Get(context.Background())
@@ -88,14 +354,22 @@ var commands = []cli.Command{
 					log.Printf("Found %d services to register", len(services))
 					deregisterServices := provider.GenerateSecured(context.Background(), services)
 					log.Printf("Found %d services to deregister", len(deregisterServices))
-					aclTokenFile := c.Parent().Parent().String(consulACLFileFlag)
-					agent := consul.NewAgent(aclTokenFile)
+					agent, err := newK8sHookAgent(c)
+					if err != nil {
+						return err
+					}
+					if err := checkToken(c, agent, services); err != nil {
+						return err
+					}
 					if len(deregisterServices) > 0 {
 						er := agent.Deregister(deregisterServices)
 						if er != nil {
 							log.Printf("Error deregistering services : %s", er)
 						}
 					}
+					if c.Bool(flagDryRun) {
+						return agent.Register(services)
+					}
 					err = provider.CheckProbe(context.Background())
 					if err != nil {
 						return fmt.Errorf("error checking services liveness: %s", err)
@@ -111,7 +385,7 @@ var commands = []cli.Command{
 					}
 					return nil
 				},
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					cli.DurationFlag{
 						Name:   flagGetPodTimeout,
 						Usage:  "change timeout for fetching pod info",
@@ -124,56 +398,29 @@ var commands = []cli.Command{
 						EnvVar: envVarHealthCheckTimeout,
 						Value:  defaultHealthCheckTimeout,
 					},
-				},
+					dryRunFlag,
+				}, wanAddressFlags...),
 			},
 			{
 				Name:  "cli",
 				Usage: "Register using data from cli",
 				Action: func(c *cli.Context) error {
 					log.Print("Registering services using data from cli. Set CONSUL_HTTP_ADDR env to appropriate agent.")
-					provider := hookflags.ServiceProvider{
-						FlagServiceName:   flagServiceName,
-						FlagPodIP:         flagPodIP,
-						FlagContainerPort: flagContainerPort,
-						FlagServiceTags:   flagServiceTags,
-						FlagCheckPath:     flagCheckPath,
-						CLIContext:        c,
-					}
+					provider := cliServiceProvider(c)
 					services, err := provider.Get(context.Background())
 					if err != nil {
 						return fmt.Errorf("error getting services to register: %s", err)
 					}
-					aclTokenFile := c.Parent().Parent().String(consulACLFileFlag)
-					agent := consul.NewAgent(aclTokenFile)
+					agent, err := newHookAgent(c)
+					if err != nil {
+						return err
+					}
+					if err := checkToken(c, agent, services); err != nil {
+						return err
+					}
 					return agent.Register(services)
 				},
-				Flags: []cli.Flag{
-					cli.StringFlag{
-						Name:   flagServiceName,
-						Usage:  "service name to register by cli",
-						EnvVar: envVarServiceName,
-					},
-					cli.StringFlag{
-						Name:   flagPodIP,
-						Usage:  "pod ip to register in consul",
-						EnvVar: envVarPodIP,
-					},
-					cli.IntFlag{
-						Name:   flagContainerPort,
-						Usage:  "container port to register in consul",
-						EnvVar: envVarContainerPort,
-					},
-					cli.StringFlag{
-						Name:   flagServiceTags,
-						Usage:  "tags to register in consul (comma delimited values: k8sPodNamespace:default,scUid:sc-11298,default-monitoring)",
-						EnvVar: envVarServiceTags,
-					},
-					cli.StringFlag{
-						Name:   flagCheckPath,
-						Usage:  "health check to register in consul",
-						EnvVar: envVarCheckPath,
-					},
-				},
+				Flags: append([]cli.Flag{dryRunFlag}, cliServiceFlags...),
 			},
 		},
 	},
@@ -185,25 +432,27 @@ var commands = []cli.Command{
 				Name:  "mesos",
 				Usage: "deregister using data from Mesos Agent API",
 				Action: func(c *cli.Context) error {
-					logger.ConfigureLogger()
+					configureLogger(c)
 					log.Print("Deregistering services using data from Mesos API")
-					provider := mesos.ServiceProvider{}
-					// TODO(medzin): Add support for timeout here
+					provider := mesosServiceProvider(c)
 					services, err := provider.Get(context.Background())
 					if err != nil {
 						return fmt.Errorf("error getting services to deregister: %s", err)
 					}
 					log.Printf("Found %d services to deregister", len(services))
-					aclTokenFile := c.Parent().Parent().String(consulACLFileFlag)
-					agent := consul.NewAgent(aclTokenFile)
-					return agent.Deregister(services)
+					agent, err := newHookAgent(c)
+					if err != nil {
+						return err
+					}
+					return deregister(agent, services, c.Duration(flagDrainTime), os.Getenv("MESOS_TASK_ID"))
 				},
+				Flags: append([]cli.Flag{drainTimeFlag, dryRunFlag}, mesosFlags...),
 			},
 			{
 				Name:  "k8s",
 				Usage: "Deregister using data from Kubernetes API",
 				Action: func(c *cli.Context) error {
-					logger.ConfigureLogger()
+					configureLogger(c)
 					log.Print("Deregistering services using data from Kubernetes API")
 					provider := k8s.ServiceProvider{
 						Timeout: c.Duration(flagGetPodTimeout),
@@ -214,9 +463,11 @@ var commands = []cli.Command{
 						return fmt.Errorf("error getting services to deregister: %s", err)
 					}
 					log.Printf("Found %d services to deregister", len(services))
-					aclTokenFile := c.Parent().Parent().String(consulACLFileFlag)
-					agent := consul.NewAgent(aclTokenFile)
-					return agent.Deregister(services)
+					agent, err := newK8sHookAgent(c)
+					if err != nil {
+						return err
+					}
+					return deregister(agent, services, c.Duration(flagDrainTime), os.Getenv("KUBERNETES_POD_NAME"))
 				},
 				Flags: []cli.Flag{
 					cli.DurationFlag{
@@ -225,6 +476,8 @@ var commands = []cli.Command{
 						EnvVar: envVarGetPodTimeout,
 						Value:  defaultGetPodTimeout,
 					},
+					drainTimeFlag,
+					dryRunFlag,
 				},
 			},
 			{
@@ -232,15 +485,47 @@ var commands = []cli.Command{
 				Usage: "Deregister using data from cli. Set CONSUL_HTTP_ADDR env to appropriate agent.",
 				Action: func(c *cli.Context) error {
 					log.Print("Deregistering services using data from cli")
+					agent, err := newHookAgent(c)
+					if err != nil {
+						return err
+					}
 					services := []consul.ServiceInstance{
 						{
 							ID: c.String(flagServiceID),
 						},
 					}
+					selector := consul.ServiceSelector{
+						Name:    c.String(flagMatchName),
+						Tag:     c.String(flagMatchTag),
+						Address: c.String(flagMatchAddress),
+						Port:    c.Int(flagMatchPort),
+					}
+					path := c.String(flagServiceConfig)
 
-					aclTokenFile := c.Parent().Parent().String(consulACLFileFlag)
-					agent := consul.NewAgent(aclTokenFile)
-					return agent.Deregister(services)
+					switch {
+					case !selector.IsEmpty():
+						if path != "" || c.String(flagServiceID) != "" {
+							return errors.New("service selectors cannot be combined with service id or config")
+						}
+						var err error
+						if services, err = agent.Find(selector); err != nil {
+							return fmt.Errorf("error getting services to deregister: %s", err)
+						}
+						for _, service := range services {
+							log.Printf("Service %q (%s at %s:%d) matches selectors", service.ID, service.Name, service.Host, service.Port)
+						}
+						if len(services) > 1 && !c.Bool(flagAllMatching) {
+							return fmt.Errorf("%d services match selectors, use --%s to deregister all of them", len(services), flagAllMatching)
+						}
+					case path != "":
+						var err error
+						if services, err = hookflags.LoadServiceDefinitions(path); err != nil {
+							return fmt.Errorf("error getting services to deregister: %s", err)
+						}
+					}
+
+					log.Printf("Found %d services to deregister", len(services))
+					return deregister(agent, services, c.Duration(flagDrainTime), c.String(flagServiceID))
 				},
 				Flags: []cli.Flag{
 					cli.StringFlag{
@@ -248,14 +533,227 @@ var commands = []cli.Command{
 						Usage:  "consul service-id to deregister by cli",
 						EnvVar: envServiceID,
 					},
+					cli.StringFlag{
+						Name:   flagServiceConfig,
+						Usage:  "service definition file, services defined in it are deregistered instead of service-id",
+						EnvVar: envVarServiceConfig,
+					},
+					cli.StringFlag{
+						Name:  flagMatchName,
+						Usage: "deregister services registered in local agent with given name",
+					},
+					cli.StringFlag{
+						Name:  flagMatchTag,
+						Usage: "deregister services registered in local agent with a tag matching given glob pattern (e.g. \"instance:pod_*\")",
+					},
+					cli.StringFlag{
+						Name:  flagMatchAddress,
+						Usage: "deregister services registered in local agent with given address",
+					},
+					cli.IntFlag{
+						Name:  flagMatchPort,
+						Usage: "deregister services registered in local agent with given port",
+					},
+					cli.BoolFlag{
+						Name:  flagAllMatching,
+						Usage: "deregister all services matching selectors, instead of failing when more than one matches",
+					},
+					drainTimeFlag,
+					dryRunFlag,
 				},
 			},
 		},
 	},
+	maintenanceCommand,
+	statusCommand,
+	renderCommand,
+	gcCommand,
 }
 
 var version string
 
+// newAgent returns Consul agent client, or the one printing requests when
+// running in dry-run mode. When auth method is configured, the agent logs in to
+// Consul, except in dry-run mode.
+func newAgent(c *cli.Context) (*consul.Agent, error) {
+	return newNamespacedAgent(c, c.GlobalString(flagConsulNamespace), false)
+}
+
+// newK8sAgent returns Consul agent using namespace mapped from the namespace of
+// the pod hook runs in.
+func newK8sAgent(c *cli.Context) (*consul.Agent, error) {
+	namespace, err := k8sConsulNamespace(c)
+	if err != nil {
+		return nil, err
+	}
+	return newNamespacedAgent(c, namespace, false)
+}
+
+// newHookAgent returns Consul agent of register and deregister commands. ACL
+// token it logs in with is stored in the login token file, so it is reused and
+// logged out by the deregister hook.
+func newHookAgent(c *cli.Context) (*consul.Agent, error) {
+	return newNamespacedAgent(c, c.GlobalString(flagConsulNamespace), true)
+}
+
+// newK8sHookAgent returns Consul agent of register and deregister commands
+// using namespace mapped from the namespace of the pod hook runs in.
+func newK8sHookAgent(c *cli.Context) (*consul.Agent, error) {
+	namespace, err := k8sConsulNamespace(c)
+	if err != nil {
+		return nil, err
+	}
+	return newNamespacedAgent(c, namespace, true)
+}
+
+// k8sConsulNamespace returns Consul namespace mapped from the namespace of the
+// pod hook runs in.
+func k8sConsulNamespace(c *cli.Context) (string, error) {
+	mapping := k8s.NamespaceMapping{
+		Default:         c.GlobalString(flagConsulNamespace),
+		Mirroring:       c.GlobalBool(flagConsulNamespaceMirroring),
+		MirroringPrefix: c.GlobalString(flagConsulNamespaceMirroringPrefix),
+	}
+	if path := c.GlobalString(flagConsulNamespaceMapFile); path != "" {
+		namespaces, err := k8s.LoadNamespaceMap(path)
+		if err != nil {
+			return "", err
+		}
+		mapping.Namespaces = namespaces
+	}
+	return mapping.ConsulNamespace(os.Getenv("KUBERNETES_POD_NAMESPACE")), nil
+}
+
+// namespaceMappingEnabled returns true when services of pods are registered in
+// Consul namespaces mapped from their Kubernetes namespaces.
+func namespaceMappingEnabled(c *cli.Context) bool {
+	return c.GlobalBool(flagConsulNamespaceMirroring) || c.GlobalString(flagConsulNamespaceMapFile) != ""
+}
+
+func newNamespacedAgent(c *cli.Context, namespace string, keepToken bool) (*consul.Agent, error) {
+	agentConfig := consul.Config{
+		Address:       c.GlobalString(flagConsulAddr),
+		TokenFile:     c.GlobalString(consulACLFileFlag),
+		CAFile:        c.GlobalString(flagConsulCAFile),
+		CertFile:      c.GlobalString(flagConsulClientCert),
+		KeyFile:       c.GlobalString(flagConsulClientKey),
+		TLSServerName: c.GlobalString(flagConsulTLSServerName),
+		Namespace:     namespace,
+		Partition:     c.GlobalString(flagConsulPartition),
+
+		KeepExistingChecks: c.GlobalBool(flagConsulKeepExistingChecks),
+	}
+	method := c.GlobalString(flagConsulLoginMethod)
+	if method == "" || c.Bool(flagDryRun) {
+		agent, err := consul.NewAgent(agentConfig)
+		if err != nil {
+			return nil, err
+		}
+		if c.Bool(flagDryRun) {
+			return agent.DryRun(os.Stdout), nil
+		}
+		return agent, nil
+	}
+
+	config := consul.LoginConfig{
+		Method:          method,
+		Namespace:       c.GlobalString(flagConsulLoginNamespace),
+		BearerTokenFile: c.GlobalString(flagConsulLoginBearerTokenFile),
+		TokenFile:       c.GlobalString(flagConsulLoginTokenFile),
+		KeepToken:       keepToken,
+	}
+	if podName := os.Getenv("KUBERNETES_POD_NAME"); podName != "" {
+		config.Meta = map[string]string{"pod": os.Getenv("KUBERNETES_POD_NAMESPACE") + "/" + podName}
+	}
+	agent, err := consul.Login(agentConfig, config)
+	if err != nil {
+		return nil, fmt.Errorf("error logging in to Consul: %s", err)
+	}
+	return agent, nil
+}
+
+// agentFactory creates Consul agent used by a command.
+type agentFactory func(c *cli.Context) (*consul.Agent, error)
+
+// checkToken verifies that Consul ACL token permits registering the services,
+// when requested.
+func checkToken(c *cli.Context, agent *consul.Agent, services []consul.ServiceInstance) error {
+	if !c.GlobalBool(flagConsulCheckToken) {
+		return nil
+	}
+	return agent.CheckToken(services)
+}
+
+// closeAgent logs out ACL token agent logged in with, unless it is kept for
+// deregistration.
+func closeAgent(agent *consul.Agent) {
+	if err := agent.Close(); err != nil {
+		log.Printf("Error logging out from Consul: %s", err)
+	}
+}
+
+// configureLogger sets up remote logging, unless running in dry-run mode where
+// stdout is reserved for printed requests.
+func configureLogger(c *cli.Context) {
+	if !c.Bool(flagDryRun) {
+		logger.ConfigureLogger()
+	}
+}
+
+func mesosServiceProvider(c *cli.Context) mesos.ServiceProvider {
+	return mesos.ServiceProvider{
+		Network: mesos.Network(c.String(flagMesosNetwork)),
+		Agent: mesos.AgentConfig{
+			URL:       c.String(flagMesosAgentURL),
+			CAFile:    c.String(flagMesosAgentCAFile),
+			Principal: c.String(flagMesosAgentPrincipal),
+			Secret:    c.String(flagMesosAgentSecret),
+			TokenFile: c.String(flagMesosAgentTokenFile),
+			Timeout:   c.Duration(flagMesosAgentTimeout),
+			API:       mesos.AgentAPI(c.String(flagMesosAgentAPI)),
+		},
+	}
+}
+
+func cliServiceProvider(c *cli.Context) hookflags.ServiceProvider {
+	return hookflags.ServiceProvider{
+		FlagServiceName:          flagServiceName,
+		FlagPodIP:                flagPodIP,
+		FlagContainerPort:        flagContainerPort,
+		FlagServiceTags:          flagServiceTags,
+		FlagCheckPath:            flagCheckPath,
+		FlagCheckType:            flagCheckType,
+		FlagCheckInterval:        flagCheckInterval,
+		FlagCheckTimeout:         flagCheckTimeout,
+		FlagCheckMethod:          flagCheckMethod,
+		FlagCheckHeaders:         flagCheckHeader,
+		FlagCheckTLSSkipVerify:   flagCheckTLSSkipVerify,
+		FlagCheckDeregisterAfter: flagCheckDeregisterAfter,
+		FlagConnectNative:        flagConnectNative,
+		FlagConfig:               flagServiceConfig,
+		CLIContext:               c,
+	}
+}
+
+// deregister removes services from Consul agent. When drain time is set, the
+// services are put into maintenance mode first and deregistered after it passes.
+func deregister(agent *consul.Agent, services []consul.ServiceInstance, drainTime time.Duration, instance string) error {
+	if drainTime > 0 && len(services) > 0 {
+		reason := "Draining before deregistration"
+		if instance != "" {
+			reason = fmt.Sprintf("Draining %s before deregistration", instance)
+		}
+		if err := agent.Drain(services, reason, drainTime); err != nil {
+			log.Printf("Error enabling maintenance mode: %s", err)
+		}
+	}
+	err := agent.Deregister(services)
+	if logoutErr := agent.Logout(); logoutErr != nil {
+		log.Printf("Error logging out from Consul: %s", logoutErr)
+	}
+	return err
+}
+
 func main() {
 	app := cli.NewApp()
 	app.Flags = []cli.Flag{
@@ -263,6 +761,78 @@ func main() {
 			Name:  consulACLFileFlag,
 			Usage: "Consul acl token file location.",
 		},
+		cli.StringFlag{
+			Name:  flagConsulAddr,
+			Usage: "Consul agent address, with optional http or https scheme, or unix:///path of agent socket (overrides CONSUL_HTTP_ADDR)",
+		},
+		cli.StringFlag{
+			Name:  flagConsulCAFile,
+			Usage: "CA certificate used to verify Consul agent, enables HTTPS (overrides CONSUL_CACERT)",
+		},
+		cli.StringFlag{
+			Name:  flagConsulClientCert,
+			Usage: "client certificate used for mTLS with Consul agent (overrides CONSUL_CLIENT_CERT)",
+		},
+		cli.StringFlag{
+			Name:  flagConsulClientKey,
+			Usage: "client key used for mTLS with Consul agent (overrides CONSUL_CLIENT_KEY)",
+		},
+		cli.StringFlag{
+			Name:  flagConsulTLSServerName,
+			Usage: "server name used to verify Consul agent certificate (overrides CONSUL_TLS_SERVER_NAME)",
+		},
+		cli.StringFlag{
+			Name:   flagConsulNamespace,
+			Usage:  "Consul Enterprise namespace services are registered in",
+			EnvVar: envVarConsulNamespace,
+		},
+		cli.StringFlag{
+			Name:   flagConsulPartition,
+			Usage:  "Consul Enterprise admin partition services are registered in",
+			EnvVar: envVarConsulPartition,
+		},
+		cli.BoolFlag{
+			Name:  flagConsulNamespaceMirroring,
+			Usage: "register services of Kubernetes pods in Consul namespace named after pod namespace",
+		},
+		cli.StringFlag{
+			Name:  flagConsulNamespaceMirroringPrefix,
+			Usage: "prefix of Consul namespaces mirroring Kubernetes namespaces",
+		},
+		cli.StringFlag{
+			Name:  flagConsulNamespaceMapFile,
+			Usage: "YAML or JSON file mapping Kubernetes namespace names to Consul namespace names",
+		},
+		cli.BoolFlag{
+			Name:   flagConsulKeepExistingChecks,
+			Usage:  "keep checks of previous registration with the same service ID instead of replacing them",
+			EnvVar: envVarConsulKeepExistingChecks,
+		},
+		cli.BoolFlag{
+			Name:   flagConsulCheckToken,
+			Usage:  "look up Consul ACL token and verify it permits registering services before registration",
+			EnvVar: envVarConsulCheckToken,
+		},
+		cli.StringFlag{
+			Name:   flagConsulLoginMethod,
+			Usage:  "Consul Kubernetes auth method used to obtain ACL token instead of acl token file",
+			EnvVar: envVarConsulLoginMethod,
+		},
+		cli.StringFlag{
+			Name:   flagConsulLoginNamespace,
+			Usage:  "Consul Enterprise namespace of the auth method, independent of the namespace services are registered in",
+			EnvVar: envVarConsulLoginNamespace,
+		},
+		cli.StringFlag{
+			Name:   flagConsulLoginBearerTokenFile,
+			Usage:  "service account JWT file exchanged for ACL token (defaults to the token mounted in the pod)",
+			EnvVar: envVarConsulLoginBearerTokenFile,
+		},
+		cli.StringFlag{
+			Name:   flagConsulLoginTokenFile,
+			Usage:  "file where ACL token obtained on register is stored, so it is reused and logged out on deregister (required by register and deregister with --consul-login-method)",
+			EnvVar: envVarConsulLoginTokenFile,
+		},
 	}
 	app.Name = "consul-registration-hook"
 	app.Description = "Hook that can be used for synchronous registration and deregistration in Consul discovery service on Kubernetes or Mesos cluster with Allegro executor"
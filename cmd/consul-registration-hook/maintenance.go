@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/allegro/consul-registration-hook/consul"
+	"github.com/allegro/consul-registration-hook/k8s"
+	"github.com/allegro/consul-registration-hook/logger"
+	"github.com/urfave/cli"
+)
+
+const (
+	flagMaintenanceReason   = "reason"
+	envVarMaintenanceReason = "CONSUL_MAINTENANCE_REASON"
+	// defaultMaintenanceReason makes maintenance enabled by the hook
+	// recognizable in Consul, like the one of draining.
+	defaultMaintenanceReason = "consul-registration-hook"
+)
+
+var maintenanceCommand = cli.Command{
+	Name:  "maintenance",
+	Usage: "Toggle Consul maintenance mode of services without deregistering them",
+	Subcommands: []cli.Command{
+		maintenanceToggleCommand("enable", "Put services into Consul maintenance mode", true),
+		maintenanceToggleCommand("disable", "Take services out of Consul maintenance mode", false),
+	},
+}
+
+// maintenanceToggleCommand returns a command that enables or disables
+// maintenance mode of services resolved by each of supported providers.
+func maintenanceToggleCommand(name, usage string, enable bool) cli.Command {
+	toggle := func(c *cli.Context, services []consul.ServiceInstance, createAgent agentFactory) error {
+		agent, err := createAgent(c)
+		if err != nil {
+			return err
+		}
+		defer closeAgent(agent)
+		if enable {
+			reason := c.String(flagMaintenanceReason)
+			if reason == "" {
+				reason = defaultMaintenanceReason
+			}
+			return agent.EnableMaintenance(services, reason)
+		}
+		return agent.DisableMaintenance(services)
+	}
+
+	var flags []cli.Flag
+	if enable {
+		flags = append(flags, cli.StringFlag{
+			Name:   flagMaintenanceReason,
+			Usage:  "reason of the maintenance visible in Consul",
+			EnvVar: envVarMaintenanceReason,
+			Value:  defaultMaintenanceReason,
+		})
+	}
+
+	return cli.Command{
+		Name:  name,
+		Usage: usage,
+		Subcommands: []cli.Command{
+			{
+				Name:  "mesos",
+				Usage: "Toggle maintenance using data from Mesos Agent API",
+				Action: func(c *cli.Context) error {
+					logger.ConfigureLogger()
+					provider := mesosServiceProvider(c)
+					services, err := provider.Get(context.Background())
+					if err != nil {
+						return fmt.Errorf("error getting services to %s maintenance: %s", name, err)
+					}
+					log.Printf("Found %d services to %s maintenance", len(services), name)
+					return toggle(c, services, newAgent)
+				},
+				Flags: append(flags, mesosFlags...),
+			},
+			{
+				Name:  "k8s",
+				Usage: "Toggle maintenance using data from Kubernetes API",
+				Action: func(c *cli.Context) error {
+					logger.ConfigureLogger()
+					provider := k8s.ServiceProvider{
+						Timeout: c.Duration(flagGetPodTimeout),
+					}
+					services, err := provider.Get(context.Background())
+					if err != nil {
+						return fmt.Errorf("error getting services to %s maintenance: %s", name, err)
+					}
+					log.Printf("Found %d services to %s maintenance", len(services), name)
+					return toggle(c, services, newK8sAgent)
+				},
+				Flags: append([]cli.Flag{
+					cli.DurationFlag{
+						Name:   flagGetPodTimeout,
+						Usage:  "change timeout for fetching pod info",
+						EnvVar: envVarGetPodTimeout,
+						Value:  defaultGetPodTimeout,
+					},
+				}, flags...),
+			},
+			{
+				Name:  "cli",
+				Usage: "Toggle maintenance using data from cli. Set CONSUL_HTTP_ADDR env to appropriate agent.",
+				Action: func(c *cli.Context) error {
+					serviceID := c.String(flagServiceID)
+					if serviceID == "" {
+						return errors.New("missing service id")
+					}
+					return toggle(c, []consul.ServiceInstance{{ID: serviceID}}, newAgent)
+				},
+				Flags: append([]cli.Flag{
+					cli.StringFlag{
+						Name:   flagServiceID,
+						Usage:  "consul service-id to toggle maintenance by cli",
+						EnvVar: envServiceID,
+					},
+				}, flags...),
+			},
+		},
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/allegro/consul-registration-hook/consul"
+	"github.com/allegro/consul-registration-hook/k8s"
+	"github.com/allegro/consul-registration-hook/mesos"
+	"github.com/urfave/cli"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+const (
+	flagPodManifest   = "pod"
+	flagNodeManifest  = "node"
+	flagContainerName = "container"
+	flagMesosState    = "state"
+	flagEnv           = "env"
+)
+
+var envFlag = cli.StringSliceFlag{
+	Name:  flagEnv,
+	Usage: "environment variable override in KEY=VALUE format, can be repeated",
+}
+
+var renderCommand = cli.Command{
+	Name: "render",
+	Usage: "Render services that would be registered from offline inputs, without cluster access.\n\n" +
+		"Services are printed as Consul agent registration requests in JSON format.",
+	Subcommands: []cli.Command{
+		{
+			Name:  "mesos",
+			Usage: "Render using Mesos Agent state file",
+			Action: func(c *cli.Context) error {
+				if err := setEnv(c.StringSlice(flagEnv)); err != nil {
+					return err
+				}
+				stateJSON, err := ioutil.ReadFile(c.String(flagMesosState))
+				if err != nil {
+					return fmt.Errorf("unable to read state file: %s", err)
+				}
+				provider := mesos.ServiceProvider{
+					Network: mesos.Network(c.String(flagMesosNetwork)),
+				}
+				services, err := provider.Render(stateJSON)
+				if err != nil {
+					return fmt.Errorf("error rendering services: %s", err)
+				}
+				return consul.NewDryRunAgent(os.Stdout).Register(services)
+			},
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  flagMesosState,
+					Usage: "Mesos agent state.json file location",
+				},
+				mesosNetworkFlag,
+				envFlag,
+			},
+		},
+		{
+			Name:  "k8s",
+			Usage: "Render using Kubernetes pod manifest file",
+			Action: func(c *cli.Context) error {
+				pod := &corev1.Pod{}
+				if err := decodeManifest(c.String(flagPodManifest), pod); err != nil {
+					return err
+				}
+				var node *corev1.Node
+				if path := c.String(flagNodeManifest); path != "" {
+					node = &corev1.Node{}
+					if err := decodeManifest(path, node); err != nil {
+						return err
+					}
+				}
+				if podIP := c.String(flagPodIP); podIP != "" {
+					pod.Status.PodIP = podIP
+				}
+				if err := setContainerEnv(pod, c.String(flagContainerName)); err != nil {
+					return err
+				}
+				if err := setEnv(c.StringSlice(flagEnv)); err != nil {
+					return err
+				}
+				provider := k8s.ServiceProvider{WANAddress: wanAddress(c)}
+				services, err := provider.Render(pod, node)
+				if err != nil {
+					return fmt.Errorf("error rendering services: %s", err)
+				}
+				return consul.NewDryRunAgent(os.Stdout).Register(services)
+			},
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:  flagPodManifest,
+					Usage: "pod manifest file location (YAML or JSON)",
+				},
+				cli.StringFlag{
+					Name:  flagNodeManifest,
+					Usage: "optional node manifest file location (YAML or JSON) used for failure domain tags and WAN address",
+				},
+				cli.StringFlag{
+					Name:  flagPodIP,
+					Usage: "pod ip used when manifest has no status.podIP",
+				},
+				cli.StringFlag{
+					Name:  flagContainerName,
+					Usage: "name of the container running the hook, its env values are used (defaults to the first one)",
+				},
+				envFlag,
+			}, wanAddressFlags...),
+		},
+	},
+}
+
+func decodeManifest(path string, into interface{}) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("unable to open manifest: %s", err)
+	}
+	defer file.Close()
+
+	if err := yaml.NewYAMLOrJSONDecoder(file, 4096).Decode(into); err != nil {
+		return fmt.Errorf("unable to decode manifest %s: %s", path, err)
+	}
+	return nil
+}
+
+// setContainerEnv exports literal env values of the container running the hook,
+// as the hook would see them inside the pod.
+func setContainerEnv(pod *corev1.Pod, containerName string) error {
+	if len(pod.Spec.Containers) == 0 {
+		return fmt.Errorf("pod has no containers")
+	}
+	container := &pod.Spec.Containers[0]
+	if containerName != "" {
+		container = nil
+		for i := range pod.Spec.Containers {
+			if pod.Spec.Containers[i].Name == containerName {
+				container = &pod.Spec.Containers[i]
+			}
+		}
+		if container == nil {
+			return fmt.Errorf("pod has no container named %q", containerName)
+		}
+	}
+
+	for _, env := range container.Env {
+		if env.ValueFrom == nil {
+			os.Setenv(env.Name, env.Value)
+		}
+	}
+	return nil
+}
+
+func setEnv(overrides []string) error {
+	for _, override := range overrides {
+		parts := strings.SplitN(override, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid env override %q, expected KEY=VALUE", override)
+		}
+		os.Setenv(parts[0], parts[1])
+	}
+	return nil
+}
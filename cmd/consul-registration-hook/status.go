@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/allegro/consul-registration-hook/consul"
+	"github.com/allegro/consul-registration-hook/k8s"
+	"github.com/allegro/consul-registration-hook/mesos"
+	"github.com/urfave/cli"
+)
+
+const (
+	flagOutputFormat   = "format"
+	envVarOutputFormat = "HOOK_OUTPUT_FORMAT"
+
+	outputFormatText = "text"
+	outputFormatJSON = "json"
+)
+
+var outputFormatFlag = cli.StringFlag{
+	Name:   flagOutputFormat,
+	Usage:  "output format (text or json)",
+	EnvVar: envVarOutputFormat,
+	Value:  outputFormatText,
+}
+
+var statusCommand = cli.Command{
+	Name: "status",
+	Usage: "Compare services that should be registered with the ones registered in Consul agent.\n\n" +
+		"Exits with non-zero code when registration differs from the desired one.",
+	Subcommands: []cli.Command{
+		{
+			Name:  "mesos",
+			Usage: "Check status using data from Mesos Agent API",
+			Action: func(c *cli.Context) error {
+				provider := mesosServiceProvider(c)
+				services, err := provider.Get(context.Background())
+				if err != nil {
+					return fmt.Errorf("error getting services to check: %s", err)
+				}
+				var owners []consul.ServiceSelector
+				for _, service := range services {
+					if taskID, ok := mesos.TaskIDFromTags(service.Tags); ok {
+						owners = append(owners, consul.ServiceSelector{Tag: mesos.MarathonTaskTag(taskID)})
+					}
+				}
+				return printStatus(c, services, owners, newAgent)
+			},
+			Flags: append([]cli.Flag{outputFormatFlag}, mesosFlags...),
+		},
+		{
+			Name:  "k8s",
+			Usage: "Check status using data from Kubernetes API",
+			Action: func(c *cli.Context) error {
+				// Provider is configured like in register, so services are
+				// compared with the ones it registers.
+				provider := k8s.ServiceProvider{
+					Timeout:            c.Duration(flagGetPodTimeout),
+					HealthCheckTimeout: c.Duration(flagHealthCheckTimeout),
+					WANAddress:         wanAddress(c),
+				}
+				services, err := provider.Get(context.Background())
+				if err != nil {
+					return fmt.Errorf("error getting services to check: %s", err)
+				}
+				owners := []consul.ServiceSelector{{Tag: k8s.PodNameTag(os.Getenv("KUBERNETES_POD_NAME"))}}
+				return printStatus(c, services, owners, newK8sAgent)
+			},
+			Flags: append([]cli.Flag{
+				cli.DurationFlag{
+					Name:   flagGetPodTimeout,
+					Usage:  "change timeout for fetching pod info",
+					EnvVar: envVarGetPodTimeout,
+					Value:  defaultGetPodTimeout,
+				},
+				cli.DurationFlag{
+					Name:   flagHealthCheckTimeout,
+					Usage:  "change consul hook timeout",
+					EnvVar: envVarHealthCheckTimeout,
+					Value:  defaultHealthCheckTimeout,
+				},
+				outputFormatFlag,
+			}, wanAddressFlags...),
+		},
+		{
+			Name:  "cli",
+			Usage: "Check status using data from cli. Set CONSUL_HTTP_ADDR env to appropriate agent.",
+			Action: func(c *cli.Context) error {
+				provider := cliServiceProvider(c)
+				services, err := provider.Get(context.Background())
+				if err != nil {
+					return fmt.Errorf("error getting services to check: %s", err)
+				}
+				// Services registered with the same name are owned by cli.
+				var owners []consul.ServiceSelector
+				for _, service := range services {
+					owners = append(owners, consul.ServiceSelector{Name: service.Name})
+				}
+				return printStatus(c, services, owners, newAgent)
+			},
+			Flags: append([]cli.Flag{outputFormatFlag}, cliServiceFlags...),
+		},
+	},
+}
+
+// printStatus prints the difference between desired services and services
+// registered in Consul agent, and returns an error when they differ.
+func printStatus(c *cli.Context, services []consul.ServiceInstance, owners []consul.ServiceSelector, createAgent agentFactory) error {
+	agent, err := createAgent(c)
+	if err != nil {
+		return err
+	}
+	defer closeAgent(agent)
+	statuses, err := agent.Status(services, owners)
+	if err != nil {
+		return err
+	}
+
+	switch format := c.String(flagOutputFormat); format {
+	case outputFormatJSON:
+		if err := writeJSON(os.Stdout, statuses); err != nil {
+			return err
+		}
+	case outputFormatText:
+		writeStatusText(os.Stdout, statuses)
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+
+	if consul.HasDrift(statuses) {
+		return errors.New("registration differs from the desired one")
+	}
+	return nil
+}
+
+func writeStatusText(w io.Writer, statuses []consul.ServiceStatus) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tSTATE\tHEALTH\tDETAILS")
+	for _, status := range statuses {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			status.ID, status.Name, status.State, status.Health, strings.Join(status.Mismatches, "; "))
+	}
+	tw.Flush()
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return fmt.Errorf("unable to encode output: %s", err)
+	}
+	return nil
+}
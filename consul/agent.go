@@ -6,6 +6,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/hashicorp/consul/api"
@@ -19,8 +20,18 @@ type CheckType string
 const (
 	// CheckHTTPGet represents HTTP GET CheckType.
 	CheckHTTPGet = CheckType("HTTP_GET")
+	// CheckHTTP represents HTTP CheckType using configurable method.
+	CheckHTTP = CheckType("HTTP")
 	// CheckTCP represents TCP CheckType.
 	CheckTCP = CheckType("TCP")
+	// CheckTTL represents TTL CheckType, updated by the service itself.
+	CheckTTL = CheckType("TTL")
+	// CheckScript represents CheckType running a command on the agent.
+	CheckScript = CheckType("SCRIPT")
+	// CheckGRPC represents gRPC health checking protocol CheckType.
+	CheckGRPC = CheckType("GRPC")
+	// CheckH2Ping represents HTTP/2 PING CheckType.
+	CheckH2Ping = CheckType("H2PING")
 )
 
 // Check represents a Consul health check definition.
@@ -29,6 +40,23 @@ type Check struct {
 	Address  string
 	Interval time.Duration
 	Timeout  time.Duration
+
+	// Name is optional, Consul generates one when empty.
+	Name string
+	// Method and Header are used by CheckHTTP checks.
+	Method string
+	Header map[string][]string
+	// TLSSkipVerify disables certificate verification of HTTPS, gRPC and
+	// HTTP/2 PING checks.
+	TLSSkipVerify bool
+	// UseTLS enables TLS for CheckGRPC and CheckH2Ping checks.
+	UseTLS bool
+	// TTL is used by CheckTTL checks.
+	TTL time.Duration
+	// Args is a command run by CheckScript checks.
+	Args []string
+	// DeregisterCriticalServiceAfter defaults to 15 minutes when empty.
+	DeregisterCriticalServiceAfter time.Duration
 }
 
 // ServiceInstance represents a Consul service that should be registered.
@@ -39,37 +67,95 @@ type ServiceInstance struct {
 	Port  int
 	Tags  []string
 	Check *Check
+	// Checks are registered in addition to Check.
+	Checks []*Check
+	// Meta is a key/value metadata of the service.
+	Meta map[string]string
+	// Weights are used in DNS SRV responses, nil means Consul defaults.
+	Weights *Weights
+	// Connect registers the service in Consul service mesh.
+	Connect *Connect
+	// TaggedAddresses are addresses of the service in other networks, keyed
+	// with one of TaggedAddress constants.
+	TaggedAddresses map[string]ServiceAddress
+	// SidecarFor is ID of the service registered sidecar proxy belongs to. It
+	// is set only on sidecar proxies read from Consul agent.
+	SidecarFor string
+	// Namespace is Consul Enterprise namespace of the service read from
+	// Consul agent, in which it is deregistered. Empty means namespace of the
+	// Agent.
+	Namespace string
+}
+
+const (
+	// TaggedAddressLAN is an address of the service in local datacenter.
+	TaggedAddressLAN = "lan"
+	// TaggedAddressLANIPv4 is an IPv4 address of the service in local datacenter.
+	TaggedAddressLANIPv4 = "lan_ipv4"
+	// TaggedAddressWAN is an address of the service used by other datacenters.
+	TaggedAddressWAN = "wan"
+	// TaggedAddressWANIPv4 is an IPv4 address of the service used by other
+	// datacenters.
+	TaggedAddressWANIPv4 = "wan_ipv4"
+	// TaggedAddressVirtual is a virtual address of the service.
+	TaggedAddressVirtual = "virtual"
+)
+
+// IsTaggedAddress returns true for keys of tagged addresses supported by Agent.
+func IsTaggedAddress(key string) bool {
+	switch key {
+	case TaggedAddressLAN, TaggedAddressLANIPv4, TaggedAddressWAN, TaggedAddressWANIPv4, TaggedAddressVirtual:
+		return true
+	}
+	return false
+}
+
+// ServiceAddress is an address and port service is reachable at.
+type ServiceAddress struct {
+	Address string
+	Port    int
+}
+
+// Weights represents weights of the service depending on its health.
+type Weights struct {
+	Passing int
+	Warning int
 }
 
 type agentClient interface {
-	ServiceRegister(*api.AgentServiceRegistration) error
-	ServiceDeregister(string) error
+	ServiceRegisterOpts(*api.AgentServiceRegistration, api.ServiceRegisterOpts) error
+	ServiceDeregisterOpts(string, *api.QueryOptions) error
+	EnableServiceMaintenance(string, string) error
+	DisableServiceMaintenance(string) error
+	Services() (map[string]*api.AgentService, error)
+	ServicesWithFilterOpts(string, *api.QueryOptions) (map[string]*api.AgentService, error)
+	Checks() (map[string]*api.AgentCheck, error)
 }
 
 // Agent is a type responsible for registering and deregistering services in
 // Consul agent.
 type Agent struct {
 	agentClient agentClient
+	dryRun      bool
+	http        *httpClient
+	session     *loginSession
+	// keepExistingChecks disables removing checks that are no longer part
+	// of re-registered service.
+	keepExistingChecks bool
 }
 
-// Register adds passed service instances to Consul discovery service.
+// Register adds passed service instances to Consul discovery service. Checks
+// registered earlier with the same service ID, but missing in the passed
+// instance, are removed unless Agent keeps existing checks.
 func (a *Agent) Register(services []ServiceInstance) error {
 	for _, service := range services {
-		var check *api.AgentServiceCheck
-		if service.Check != nil {
-			check = &api.AgentServiceCheck{
-				Interval:                       service.Check.Interval.String(),
-				Timeout:                        service.Check.Timeout.String(),
-				DeregisterCriticalServiceAfter: defaultDeregisterCriticalServiceAfter,
-			}
+		if err := service.Connect.Validate(); err != nil {
+			return fmt.Errorf("Error registering service %q in Consul agent: %s", service.Name, err)
+		}
 
-			switch service.Check.Type {
-			case CheckHTTPGet:
-				check.HTTP = service.Check.Address
-				check.Method = http.MethodGet
-			case CheckTCP:
-				check.TCP = service.Check.Address
-			}
+		var checks api.AgentServiceChecks
+		for _, check := range service.Checks {
+			checks = append(checks, toAgentServiceCheck(check))
 		}
 
 		apiServiceInstance := &api.AgentServiceRegistration{
@@ -78,11 +164,29 @@ func (a *Agent) Register(services []ServiceInstance) error {
 			Port:    service.Port,
 			Address: service.Host,
 			Tags:    service.Tags,
-			Check:   check,
+			Check:   toAgentServiceCheck(service.Check),
+			Checks:  checks,
+			Meta:    service.Meta,
+			Connect: toAgentServiceConnect(service.Connect),
+		}
+		for key, address := range service.TaggedAddresses {
+			if !IsTaggedAddress(key) {
+				return fmt.Errorf("Error registering service %q in Consul agent: unknown tagged address %q", service.Name, key)
+			}
+			if apiServiceInstance.TaggedAddresses == nil {
+				apiServiceInstance.TaggedAddresses = map[string]api.ServiceAddress{}
+			}
+			apiServiceInstance.TaggedAddresses[key] = api.ServiceAddress{Address: address.Address, Port: address.Port}
+		}
+		if service.Weights != nil {
+			apiServiceInstance.Weights = &api.AgentWeights{
+				Passing: service.Weights.Passing,
+				Warning: service.Weights.Warning,
+			}
 		}
 
 		log.Printf("Registering %q service in Consul agent", service.Name)
-		if err := a.agentClient.ServiceRegister(apiServiceInstance); err != nil {
+		if err := a.agentClient.ServiceRegisterOpts(apiServiceInstance, api.ServiceRegisterOpts{ReplaceExistingChecks: !a.keepExistingChecks}); err != nil {
 			return fmt.Errorf("Error registering service %q in Consul agent: %s", service.Name, err)
 		}
 	}
@@ -90,13 +194,81 @@ func (a *Agent) Register(services []ServiceInstance) error {
 	return nil
 }
 
-// Deregister removes passed service instances from Consul discovery service.
+func toAgentServiceCheck(c *Check) *api.AgentServiceCheck {
+	if c == nil {
+		return nil
+	}
+
+	check := &api.AgentServiceCheck{
+		Name:                           c.Name,
+		DeregisterCriticalServiceAfter: defaultDeregisterCriticalServiceAfter,
+	}
+	if c.DeregisterCriticalServiceAfter > 0 {
+		check.DeregisterCriticalServiceAfter = c.DeregisterCriticalServiceAfter.String()
+	}
+	if c.Type != CheckTTL {
+		check.Interval = c.Interval.String()
+		check.Timeout = c.Timeout.String()
+	}
+
+	switch c.Type {
+	case CheckHTTPGet:
+		check.HTTP = c.Address
+		check.Method = http.MethodGet
+	case CheckHTTP:
+		check.HTTP = c.Address
+		check.Method = c.Method
+		check.Header = c.Header
+		check.TLSSkipVerify = c.TLSSkipVerify
+	case CheckTCP:
+		check.TCP = c.Address
+	case CheckTTL:
+		check.TTL = c.TTL.String()
+	case CheckScript:
+		check.Args = c.Args
+	case CheckGRPC:
+		check.GRPC = c.Address
+		check.GRPCUseTLS = c.UseTLS
+		check.TLSSkipVerify = c.TLSSkipVerify
+	case CheckH2Ping:
+		check.H2PING = c.Address
+		check.H2PingUseTLS = c.UseTLS
+		check.TLSSkipVerify = c.TLSSkipVerify
+	}
+
+	return check
+}
+
+// Deregister removes passed service instances from Consul discovery service,
+// together with their sidecar proxies. Sidecar proxies passed together with
+// their services are skipped, as Consul removes them with the service.
 func (a *Agent) Deregister(services []ServiceInstance) error {
 	var errs []error
 
+	ids := make(map[string]bool, len(services))
 	for _, service := range services {
+		ids[service.Namespace+"/"+service.ID] = true
+	}
+
+	for _, service := range services {
+		if service.SidecarFor != "" && ids[service.Namespace+"/"+service.SidecarFor] {
+			log.Printf("Skipping %q sidecar proxy removed with %q service", service.ID, service.SidecarFor)
+			continue
+		}
+		var opts *api.QueryOptions
+		if service.Namespace != "" {
+			opts = &api.QueryOptions{Namespace: service.Namespace}
+		}
+		if service.Connect != nil && service.Connect.Sidecar != nil {
+			// Sidecar is deregistered first, because Consul removes it with
+			// the service and its deregistration would fail afterwards.
+			log.Printf("Deregistering %q sidecar proxy in Consul agent", service.ID)
+			if err := a.agentClient.ServiceDeregisterOpts(sidecarProxyID(service.ID), opts); err != nil {
+				errs = append(errs, err)
+			}
+		}
 		log.Printf("Deregistering %q service in Consul agent", service.ID)
-		if err := a.agentClient.ServiceDeregister(service.ID); err != nil {
+		if err := a.agentClient.ServiceDeregisterOpts(service.ID, opts); err != nil {
 			errs = append(errs, err)
 		}
 	}
@@ -108,25 +280,153 @@ func (a *Agent) Deregister(services []ServiceInstance) error {
 	return nil
 }
 
-// NewAgent returns a new Agent.
-func NewAgent(tokenFile string) *Agent {
+// EnableMaintenance puts passed service instances into maintenance mode, which
+// marks them as critical and excludes them from healthy instances.
+func (a *Agent) EnableMaintenance(services []ServiceInstance, reason string) error {
+	var errs []error
+
+	for _, service := range services {
+		log.Printf("Enabling maintenance mode for %q service in Consul agent", service.ID)
+		if err := a.agentClient.EnableServiceMaintenance(service.ID, reason); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", errs)
+	}
+
+	return nil
+}
+
+// DisableMaintenance takes passed service instances out of maintenance mode.
+func (a *Agent) DisableMaintenance(services []ServiceInstance) error {
+	var errs []error
+
+	for _, service := range services {
+		log.Printf("Disabling maintenance mode for %q service in Consul agent", service.ID)
+		if err := a.agentClient.DisableServiceMaintenance(service.ID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", errs)
+	}
+
+	return nil
+}
+
+// Drain puts passed service instances into maintenance mode and waits for the
+// given drain time, so health-aware clients can stop picking them before they
+// are deregistered. It waits even if some instances could not be put into
+// maintenance mode.
+func (a *Agent) Drain(services []ServiceInstance, reason string, drainTime time.Duration) error {
+	err := a.EnableMaintenance(services, reason)
+
+	log.Printf("Waiting %s for clients to drain", drainTime)
+	if !a.dryRun {
+		time.Sleep(drainTime)
+	}
+
+	return err
+}
+
+// Config configures connection to Consul agent. Empty fields fall back to
+// environmental variables used by Consul CLI (e.g. CONSUL_HTTP_ADDR or
+// CONSUL_CACERT).
+type Config struct {
+	// Address of Consul agent, with optional http or https scheme, or path of
+	// unix domain socket the agent listens on (e.g. unix:///consul/http.sock).
+	Address string
+	// TokenFile contains ACL token, CONSUL_HTTP_TOKEN is used when empty.
+	TokenFile string
+	// CAFile is a PEM encoded certificate authority used to verify agent.
+	CAFile string
+	// CertFile and KeyFile are client certificate and key used for mTLS.
+	CertFile string
+	KeyFile  string
+	// TLSServerName is a server name used to verify agent certificate.
+	TLSServerName string
+	// Namespace and Partition scope all requests to Consul Enterprise
+	// namespace and admin partition.
+	Namespace string
+	Partition string
+	// KeepExistingChecks disables replacing checks of re-registered services,
+	// so checks of previous registration with the same ID are left in place.
+	KeepExistingChecks bool
+}
+
+func (c Config) usesTLS() bool {
+	return c.CAFile != "" || c.CertFile != "" || c.KeyFile != "" || c.TLSServerName != ""
+}
+
+// apiConfig returns Consul API client configuration, with passed options
+// layered over ones taken from environment. HTTPS is used when TLS options are
+// passed, unless address has explicit scheme.
+func (c Config) apiConfig() (*api.Config, error) {
 	config := api.DefaultConfig()
-	// at this point Token is empty string, if token was not passed on commandline we will just use not secure client
-	config.Token = getAgentToken(tokenFile)
-	consulClient, _ := api.NewClient(config)
+	// token is empty string when it was not passed, then we will just use not secure client
+	token, err := getAgentToken(c.TokenFile)
+	if err != nil {
+		return nil, err
+	}
+	config.Token = token
+
+	if c.Address != "" {
+		config.Address = c.Address
+	}
+	if c.CAFile != "" {
+		config.TLSConfig.CAFile = c.CAFile
+	}
+	if c.CertFile != "" {
+		config.TLSConfig.CertFile = c.CertFile
+	}
+	if c.KeyFile != "" {
+		config.TLSConfig.KeyFile = c.KeyFile
+	}
+	if c.TLSServerName != "" {
+		config.TLSConfig.Address = c.TLSServerName
+	}
+	if c.Namespace != "" {
+		config.Namespace = c.Namespace
+	}
+	if c.Partition != "" {
+		config.Partition = c.Partition
+	}
+	if c.usesTLS() && !strings.Contains(config.Address, "://") {
+		config.Scheme = "https"
+	}
+
+	return config, nil
+}
+
+// NewAgent returns a new Agent. It fails when token file is passed but cannot
+// be read, or TLS configuration is invalid.
+func NewAgent(config Config) (*Agent, error) {
+	apiConfig, err := config.apiConfig()
+	if err != nil {
+		return nil, err
+	}
+	consulClient, err := api.NewClient(apiConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create Consul client: %s", err)
+	}
 	agent := consulClient.Agent()
-	return &Agent{agentClient: agent}
+	return &Agent{agentClient: agent, http: &httpClient{config: apiConfig}, keepExistingChecks: config.KeepExistingChecks}, nil
 }
 
-func getAgentToken(tokenFile string) string {
+// getAgentToken returns token read from the file or environment, without
+// surrounding whitespace which Kubernetes Secrets commonly include.
+func getAgentToken(tokenFile string) (string, error) {
 	if !isEmpty(tokenFile) {
 		aclBinaryToken, err := ioutil.ReadFile(tokenFile)
 		if err != nil {
-			log.Printf("unable to read token from file: %s, %s", tokenFile, err)
+			return "", fmt.Errorf("unable to read token from file: %s", err)
 		}
-		return string(aclBinaryToken)
+		return strings.TrimSpace(string(aclBinaryToken)), nil
 	}
-	return os.Getenv(api.HTTPTokenEnvName)
+	return strings.TrimSpace(os.Getenv(api.HTTPTokenEnvName)), nil
 }
 
 func isEmpty(input string) bool {
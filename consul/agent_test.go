@@ -1,29 +1,84 @@
 package consul
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/hashicorp/consul/api"
 	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
 
 func TestGetsConsulACLToken(t *testing.T) {
-	actualToken := getAgentToken("testdata/consul-acl-token.txt")
+	actualToken, err := getAgentToken("testdata/consul-acl-token.txt")
 	expectedToken := "testToken"
+	require.NoError(t, err)
 	require.Equal(t, expectedToken, actualToken)
 }
 
 func TestGetsConsulACLTokenFromEnvironmentVariable(t *testing.T) {
 	os.Setenv(api.HTTPTokenEnvName, "nonStandardToken")
-	actualToken := getAgentToken("")
+	actualToken, err := getAgentToken("")
 	expectedToken := "nonStandardToken"
+	require.NoError(t, err)
 	require.Equal(t, expectedToken, actualToken)
 }
 
+func TestIfFailsWhenConsulACLTokenFileIsMissing(t *testing.T) {
+	_, err := NewAgent(Config{TokenFile: "testdata/missing-token.txt"})
+
+	require.EqualError(t, err, "unable to read token from file: open testdata/missing-token.txt: no such file or directory")
+}
+
+func TestIfLayersAgentConfigOverEnvironment(t *testing.T) {
+	for name, value := range map[string]string{
+		api.HTTPAddrEnvName:   "192.0.2.2:8500",
+		api.HTTPCAFile:        "env-ca.pem",
+		api.HTTPTLSServerName: "env.consul",
+	} {
+		os.Setenv(name, value)
+		defer os.Unsetenv(name)
+	}
+
+	config, err := Config{}.apiConfig()
+
+	require.NoError(t, err)
+	require.Equal(t, "192.0.2.2:8500", config.Address)
+	require.Equal(t, "http", config.Scheme)
+	require.Equal(t, "env-ca.pem", config.TLSConfig.CAFile)
+
+	config, err = Config{
+		Address:       "192.0.2.3:8501",
+		CAFile:        "ca.pem",
+		CertFile:      "client.pem",
+		KeyFile:       "client-key.pem",
+		TLSServerName: "agent.consul",
+	}.apiConfig()
+
+	require.NoError(t, err)
+	require.Equal(t, "192.0.2.3:8501", config.Address)
+	require.Equal(t, "https", config.Scheme)
+	require.Equal(t, api.TLSConfig{
+		Address:  "agent.consul",
+		CAFile:   "ca.pem",
+		CertFile: "client.pem",
+		KeyFile:  "client-key.pem",
+	}, config.TLSConfig)
+}
+
+func TestIfFailsToCreateAgentWithInvalidTLSConfig(t *testing.T) {
+	_, err := NewAgent(Config{CertFile: "testdata/missing-cert.pem", KeyFile: "testdata/missing-key.pem"})
+
+	require.EqualError(t, err, "unable to create Consul client: open testdata/missing-cert.pem: no such file or directory")
+}
+
 func TestIfRegistersServiceInConsul(t *testing.T) {
 	service := ServiceInstance{
 		ID:   "id",
@@ -39,13 +94,13 @@ func TestIfRegistersServiceInConsul(t *testing.T) {
 	}
 
 	mockAgentClient := &MockAgentClient{}
-	mockAgentClient.On("ServiceRegister", mock.MatchedBy(func(registration *api.AgentServiceRegistration) bool {
+	mockAgentClient.On("ServiceRegisterOpts", mock.MatchedBy(func(registration *api.AgentServiceRegistration) bool {
 		return registration.ID == service.ID &&
 			registration.Name == service.Name &&
 			registration.Address == service.Host &&
 			registration.Port == service.Port
 
-	})).Return(nil).Once()
+	}), mock.Anything).Return(nil).Once()
 
 	agent := Agent{agentClient: mockAgentClient}
 
@@ -65,9 +120,9 @@ func TestIfRegistersServiceWithTagsInConsul(t *testing.T) {
 	}
 
 	mockAgentClient := &MockAgentClient{}
-	mockAgentClient.On("ServiceRegister", mock.MatchedBy(func(registration *api.AgentServiceRegistration) bool {
+	mockAgentClient.On("ServiceRegisterOpts", mock.MatchedBy(func(registration *api.AgentServiceRegistration) bool {
 		return registration.Tags[0] == "tag"
-	})).Return(nil).Once()
+	}), mock.Anything).Return(nil).Once()
 
 	agent := Agent{agentClient: mockAgentClient}
 
@@ -77,6 +132,154 @@ func TestIfRegistersServiceWithTagsInConsul(t *testing.T) {
 	mockAgentClient.AssertExpectations(t)
 }
 
+func TestIfRegistersAdditionalChecksInConsul(t *testing.T) {
+	service := ServiceInstance{
+		ID:   "id",
+		Name: "serviceName",
+		Checks: []*Check{
+			{Type: CheckHTTP, Address: "https://myhost:1234", Method: "HEAD", TLSSkipVerify: true, Interval: time.Second},
+			{Type: CheckTTL, TTL: time.Minute, DeregisterCriticalServiceAfter: time.Hour},
+		},
+	}
+
+	mockAgentClient := &MockAgentClient{}
+	mockAgentClient.On("ServiceRegisterOpts", mock.MatchedBy(func(registration *api.AgentServiceRegistration) bool {
+		return registration.Check == nil &&
+			len(registration.Checks) == 2 &&
+			registration.Checks[0].HTTP == "https://myhost:1234" &&
+			registration.Checks[0].Method == "HEAD" &&
+			registration.Checks[0].TLSSkipVerify &&
+			registration.Checks[0].DeregisterCriticalServiceAfter == "15m" &&
+			registration.Checks[1].TTL == "1m0s" &&
+			registration.Checks[1].Interval == "" &&
+			registration.Checks[1].DeregisterCriticalServiceAfter == "1h0m0s"
+	}), mock.Anything).Return(nil).Once()
+
+	agent := Agent{agentClient: mockAgentClient}
+
+	err := agent.Register([]ServiceInstance{service})
+
+	require.NoError(t, err)
+	mockAgentClient.AssertExpectations(t)
+}
+
+func TestIfRegistersServiceMetaWeightsAndGRPCCheckInConsul(t *testing.T) {
+	service := ServiceInstance{
+		ID:      "id",
+		Name:    "serviceName",
+		Meta:    map[string]string{"version": "2"},
+		Weights: &Weights{Passing: 10, Warning: 1},
+		Check:   &Check{Type: CheckGRPC, Address: "myhost:1234/api.Health", UseTLS: true, Interval: time.Second},
+	}
+
+	mockAgentClient := &MockAgentClient{}
+	mockAgentClient.On("ServiceRegisterOpts", mock.MatchedBy(func(registration *api.AgentServiceRegistration) bool {
+		return registration.Meta["version"] == "2" &&
+			*registration.Weights == api.AgentWeights{Passing: 10, Warning: 1} &&
+			registration.Check.GRPC == "myhost:1234/api.Health" &&
+			registration.Check.GRPCUseTLS
+	}), mock.Anything).Return(nil).Once()
+
+	agent := Agent{agentClient: mockAgentClient}
+
+	err := agent.Register([]ServiceInstance{service})
+
+	require.NoError(t, err)
+	mockAgentClient.AssertExpectations(t)
+}
+
+func TestIfRegistersTaggedAddressesInConsul(t *testing.T) {
+	service := ServiceInstance{
+		ID:   "id",
+		Name: "serviceName",
+		Host: "10.0.0.2",
+		Port: 8080,
+		TaggedAddresses: map[string]ServiceAddress{
+			TaggedAddressLANIPv4: {Address: "10.0.0.2", Port: 8080},
+			TaggedAddressWAN:     {Address: "198.51.100.2", Port: 30080},
+		},
+	}
+
+	mockAgentClient := &MockAgentClient{}
+	mockAgentClient.On("ServiceRegisterOpts", mock.MatchedBy(func(registration *api.AgentServiceRegistration) bool {
+		return len(registration.TaggedAddresses) == 2 &&
+			registration.TaggedAddresses["lan_ipv4"] == api.ServiceAddress{Address: "10.0.0.2", Port: 8080} &&
+			registration.TaggedAddresses["wan"] == api.ServiceAddress{Address: "198.51.100.2", Port: 30080}
+	}), mock.Anything).Return(nil).Once()
+
+	agent := Agent{agentClient: mockAgentClient}
+
+	err := agent.Register([]ServiceInstance{service})
+
+	require.NoError(t, err)
+	mockAgentClient.AssertExpectations(t)
+}
+
+func TestIfFailsToRegisterUnknownTaggedAddress(t *testing.T) {
+	agent := Agent{agentClient: &MockAgentClient{}}
+
+	err := agent.Register([]ServiceInstance{{
+		Name:            "serviceName",
+		TaggedAddresses: map[string]ServiceAddress{"public": {Address: "198.51.100.2"}},
+	}})
+
+	require.EqualError(t, err, `Error registering service "serviceName" in Consul agent: unknown tagged address "public"`)
+}
+
+func TestIfReplacesStaleChecksOnReregistration(t *testing.T) {
+	for name, testCase := range map[string]struct {
+		keepExistingChecks bool
+		expectedChecks     []string
+	}{
+		"replacing": {expectedChecks: []string{"service:id:1"}},
+		"keeping":   {keepExistingChecks: true, expectedChecks: []string{"service:id:1", "service:id:2"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			// Fake agent numbers checks like Consul does for services with
+			// multiple checks.
+			checks := map[string]*api.AgentCheck{}
+			server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/v1/agent/service/register":
+					registration := api.AgentServiceRegistration{}
+					json.NewDecoder(r.Body).Decode(&registration)
+					if r.URL.Query().Get("replace-existing-checks") == "true" {
+						for id, check := range checks {
+							if check.ServiceID == registration.ID {
+								delete(checks, id)
+							}
+						}
+					}
+					for i := range registration.Checks {
+						id := fmt.Sprintf("service:%s:%d", registration.ID, i+1)
+						checks[id] = &api.AgentCheck{CheckID: id, ServiceID: registration.ID}
+					}
+				case "/v1/agent/checks":
+					json.NewEncoder(rw).Encode(checks)
+				}
+			}))
+			defer server.Close()
+
+			agent, err := NewAgent(Config{Address: server.URL, KeepExistingChecks: testCase.keepExistingChecks})
+			require.NoError(t, err)
+
+			tcpCheck := &Check{Type: CheckTCP, Address: "myhost:1234", Interval: time.Second}
+			ttlCheck := &Check{Type: CheckTTL, TTL: time.Minute}
+			require.NoError(t, agent.Register([]ServiceInstance{{ID: "id", Name: "name", Checks: []*Check{tcpCheck, ttlCheck}}}))
+			require.NoError(t, agent.Register([]ServiceInstance{{ID: "id", Name: "name", Checks: []*Check{tcpCheck}}}))
+
+			registeredChecks, err := agent.agentClient.Checks()
+
+			require.NoError(t, err)
+			var ids []string
+			for id := range registeredChecks {
+				ids = append(ids, id)
+			}
+			assert.ElementsMatch(t, testCase.expectedChecks, ids)
+		})
+	}
+}
+
 func TestIfDeregistersServicesInConsul(t *testing.T) {
 	services := []ServiceInstance{
 		{ID: "id1"},
@@ -84,8 +287,8 @@ func TestIfDeregistersServicesInConsul(t *testing.T) {
 	}
 
 	mockAgentClient := &MockAgentClient{}
-	mockAgentClient.On("ServiceDeregister", "id1").Return(nil).Once()
-	mockAgentClient.On("ServiceDeregister", "id2").Return(nil).Once()
+	mockAgentClient.On("ServiceDeregisterOpts", "id1", mock.Anything).Return(nil).Once()
+	mockAgentClient.On("ServiceDeregisterOpts", "id2", mock.Anything).Return(nil).Once()
 
 	agent := Agent{agentClient: mockAgentClient}
 
@@ -95,6 +298,60 @@ func TestIfDeregistersServicesInConsul(t *testing.T) {
 	mockAgentClient.AssertExpectations(t)
 }
 
+func TestIfSkipsSidecarProxiesDeregisteredWithTheirServices(t *testing.T) {
+	mockAgentClient := &MockAgentClient{}
+	mockAgentClient.On("Services").Return(map[string]*api.AgentService{
+		"id1": {Service: "a"},
+		"id1-sidecar-proxy": {
+			Kind:    api.ServiceKindConnectProxy,
+			Service: "a-sidecar-proxy",
+			Proxy:   &api.AgentServiceConnectProxyConfig{DestinationServiceID: "id1"},
+		},
+		"id2-sidecar-proxy": {
+			Kind:    api.ServiceKindConnectProxy,
+			Service: "b-sidecar-proxy",
+			Proxy:   &api.AgentServiceConnectProxyConfig{DestinationServiceID: "id2"},
+		},
+	}, nil)
+	mockAgentClient.On("ServiceDeregisterOpts", "id1", mock.Anything).Return(nil).Once()
+	mockAgentClient.On("ServiceDeregisterOpts", "id2-sidecar-proxy", mock.Anything).Return(nil).Once()
+
+	agent := Agent{agentClient: mockAgentClient}
+
+	services, err := agent.Services()
+	require.NoError(t, err)
+	require.Len(t, services, 3)
+	assert.Equal(t, "id1", services[1].SidecarFor)
+
+	err = agent.Deregister(services)
+
+	require.NoError(t, err)
+	mockAgentClient.AssertExpectations(t)
+	mockAgentClient.AssertNumberOfCalls(t, "ServiceDeregisterOpts", 2)
+}
+
+func TestIfDeregistersServicesInTheirNamespaces(t *testing.T) {
+	mockAgentClient := &MockAgentClient{}
+	mockAgentClient.On("ServicesWithFilterOpts", "", &api.QueryOptions{Namespace: "*"}).Return(map[string]*api.AgentService{
+		"id1": {Service: "a", Namespace: "team-a"},
+		"id2": {Service: "b", Namespace: "team-b"},
+	}, nil)
+	mockAgentClient.On("ServiceDeregisterOpts", "id1", &api.QueryOptions{Namespace: "team-a"}).Return(nil).Once()
+	mockAgentClient.On("ServiceDeregisterOpts", "id2", &api.QueryOptions{Namespace: "team-b"}).Return(nil).Once()
+
+	agent := Agent{agentClient: mockAgentClient}
+
+	services, err := agent.ServicesInAllNamespaces()
+	require.NoError(t, err)
+	require.Len(t, services, 2)
+	assert.Equal(t, "team-a", services[0].Namespace)
+
+	err = agent.Deregister(services)
+
+	require.NoError(t, err)
+	mockAgentClient.AssertExpectations(t)
+}
+
 func TestIfTriesToDeregisterRegardlessOfErrors(t *testing.T) {
 	services := []ServiceInstance{
 		{ID: "id1"},
@@ -102,8 +359,8 @@ func TestIfTriesToDeregisterRegardlessOfErrors(t *testing.T) {
 	}
 
 	mockAgentClient := &MockAgentClient{}
-	mockAgentClient.On("ServiceDeregister", "id1").Return(errors.New("error")).Once()
-	mockAgentClient.On("ServiceDeregister", "id2").Return(errors.New("error")).Once()
+	mockAgentClient.On("ServiceDeregisterOpts", "id1", mock.Anything).Return(errors.New("error")).Once()
+	mockAgentClient.On("ServiceDeregisterOpts", "id2", mock.Anything).Return(errors.New("error")).Once()
 
 	agent := Agent{agentClient: mockAgentClient}
 
@@ -113,16 +370,77 @@ func TestIfTriesToDeregisterRegardlessOfErrors(t *testing.T) {
 	mockAgentClient.AssertExpectations(t)
 }
 
+func TestIfPutsServicesIntoMaintenanceBeforeDraining(t *testing.T) {
+	services := []ServiceInstance{
+		{ID: "id1"},
+		{ID: "id2"},
+	}
+
+	mockAgentClient := &MockAgentClient{}
+	mockAgentClient.On("EnableServiceMaintenance", "id1", "reason").Return(nil).Once()
+	mockAgentClient.On("EnableServiceMaintenance", "id2", "reason").Return(errors.New("error")).Once()
+
+	agent := Agent{agentClient: mockAgentClient}
+
+	err := agent.Drain(services, "reason", time.Millisecond)
+
+	require.Error(t, err)
+	mockAgentClient.AssertExpectations(t)
+}
+
+func TestIfDisablesMaintenanceForAllServices(t *testing.T) {
+	services := []ServiceInstance{
+		{ID: "id1"},
+		{ID: "id2"},
+	}
+
+	mockAgentClient := &MockAgentClient{}
+	mockAgentClient.On("DisableServiceMaintenance", "id1").Return(nil).Once()
+	mockAgentClient.On("DisableServiceMaintenance", "id2").Return(nil).Once()
+
+	agent := Agent{agentClient: mockAgentClient}
+
+	err := agent.DisableMaintenance(services)
+
+	require.NoError(t, err)
+	mockAgentClient.AssertExpectations(t)
+}
+
 type MockAgentClient struct {
 	mock.Mock
 }
 
-func (m *MockAgentClient) ServiceRegister(agentServiceRegistration *api.AgentServiceRegistration) error {
-	args := m.Called(agentServiceRegistration)
+func (m *MockAgentClient) ServiceRegisterOpts(agentServiceRegistration *api.AgentServiceRegistration, opts api.ServiceRegisterOpts) error {
+	args := m.Called(agentServiceRegistration, opts)
 	return args.Error(0)
 }
 
-func (m *MockAgentClient) ServiceDeregister(serviceID string) error {
+func (m *MockAgentClient) ServiceDeregisterOpts(serviceID string, q *api.QueryOptions) error {
+	args := m.Called(serviceID, q)
+	return args.Error(0)
+}
+
+func (m *MockAgentClient) EnableServiceMaintenance(serviceID, reason string) error {
+	args := m.Called(serviceID, reason)
+	return args.Error(0)
+}
+
+func (m *MockAgentClient) DisableServiceMaintenance(serviceID string) error {
 	args := m.Called(serviceID)
 	return args.Error(0)
 }
+
+func (m *MockAgentClient) Services() (map[string]*api.AgentService, error) {
+	args := m.Called()
+	return args.Get(0).(map[string]*api.AgentService), args.Error(1)
+}
+
+func (m *MockAgentClient) ServicesWithFilterOpts(filter string, q *api.QueryOptions) (map[string]*api.AgentService, error) {
+	args := m.Called(filter, q)
+	return args.Get(0).(map[string]*api.AgentService), args.Error(1)
+}
+
+func (m *MockAgentClient) Checks() (map[string]*api.AgentCheck, error) {
+	args := m.Called()
+	return args.Get(0).(map[string]*api.AgentCheck), args.Error(1)
+}
@@ -0,0 +1,80 @@
+package consul
+
+import (
+	"errors"
+
+	"github.com/hashicorp/consul/api"
+)
+
+const sidecarProxyIDSuffix = "-sidecar-proxy"
+
+// Connect configures Consul service mesh registration of the service.
+type Connect struct {
+	// Native marks service that accepts Connect mTLS connections itself,
+	// using Connect SDK instead of a proxy.
+	Native bool
+	// Sidecar registers Connect sidecar proxy together with the service.
+	Sidecar *SidecarProxy
+}
+
+// Validate returns error when Connect configuration is contradictory.
+func (c *Connect) Validate() error {
+	if c != nil && c.Native && c.Sidecar != nil {
+		return errors.New("native Connect service cannot have sidecar proxy")
+	}
+	return nil
+}
+
+// SidecarProxy is a Connect sidecar proxy registered as a sidecar service of
+// the service it proxies to.
+type SidecarProxy struct {
+	// Port proxy accepts inbound mTLS connections on, Consul assigns one from
+	// its sidecar port range when zero.
+	Port int
+	// LocalServicePort is a port of the app proxy forwards inbound connections
+	// to, defaults to port of the service.
+	LocalServicePort int
+	// Upstreams are services the app connects to through the proxy.
+	Upstreams []Upstream
+}
+
+// Upstream is a service exposed to the app on local port by its proxy.
+type Upstream struct {
+	DestinationName string
+	LocalBindPort   int
+}
+
+// sidecarProxyID returns ID Consul gives to sidecar service of the service.
+func sidecarProxyID(serviceID string) string {
+	return serviceID + sidecarProxyIDSuffix
+}
+
+func toAgentServiceConnect(c *Connect) *api.AgentServiceConnect {
+	if c == nil {
+		return nil
+	}
+	if c.Native {
+		return &api.AgentServiceConnect{Native: true}
+	}
+	if c.Sidecar == nil {
+		return nil
+	}
+
+	proxy := &api.AgentServiceConnectProxyConfig{
+		LocalServicePort: c.Sidecar.LocalServicePort,
+	}
+	for _, upstream := range c.Sidecar.Upstreams {
+		proxy.Upstreams = append(proxy.Upstreams, api.Upstream{
+			DestinationType: api.UpstreamDestTypeService,
+			DestinationName: upstream.DestinationName,
+			LocalBindPort:   upstream.LocalBindPort,
+		})
+	}
+
+	return &api.AgentServiceConnect{
+		SidecarService: &api.AgentServiceRegistration{
+			Port:  c.Sidecar.Port,
+			Proxy: proxy,
+		},
+	}
+}
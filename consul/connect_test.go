@@ -0,0 +1,84 @@
+package consul
+
+import (
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIfRegistersServiceWithSidecarProxy(t *testing.T) {
+	service := ServiceInstance{
+		ID:   "id",
+		Name: "serviceName",
+		Port: 8080,
+		Connect: &Connect{Sidecar: &SidecarProxy{
+			Port:      21000,
+			Upstreams: []Upstream{{DestinationName: "db", LocalBindPort: 5432}},
+		}},
+	}
+
+	mockAgentClient := &MockAgentClient{}
+	mockAgentClient.On("ServiceRegisterOpts", mock.MatchedBy(func(registration *api.AgentServiceRegistration) bool {
+		sidecar := registration.Connect.SidecarService
+		return sidecar.Port == 21000 &&
+			sidecar.Proxy.LocalServicePort == 0 &&
+			len(sidecar.Proxy.Upstreams) == 1 &&
+			sidecar.Proxy.Upstreams[0].DestinationName == "db" &&
+			sidecar.Proxy.Upstreams[0].LocalBindPort == 5432
+	}), mock.Anything).Return(nil).Once()
+
+	agent := Agent{agentClient: mockAgentClient}
+
+	err := agent.Register([]ServiceInstance{service})
+
+	require.NoError(t, err)
+	mockAgentClient.AssertExpectations(t)
+}
+
+func TestIfDeregistersSidecarProxyBeforeService(t *testing.T) {
+	services := []ServiceInstance{
+		{ID: "id", Connect: &Connect{Sidecar: &SidecarProxy{}}},
+	}
+
+	var deregistered []string
+	mockAgentClient := &MockAgentClient{}
+	mockAgentClient.On("ServiceDeregisterOpts", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		deregistered = append(deregistered, args.String(0))
+	}).Return(nil).Twice()
+
+	agent := Agent{agentClient: mockAgentClient}
+
+	err := agent.Deregister(services)
+
+	require.NoError(t, err)
+	require.Equal(t, []string{"id-sidecar-proxy", "id"}, deregistered)
+	mockAgentClient.AssertExpectations(t)
+}
+
+func TestIfRegistersNativeConnectService(t *testing.T) {
+	mockAgentClient := &MockAgentClient{}
+	mockAgentClient.On("ServiceRegisterOpts", mock.MatchedBy(func(registration *api.AgentServiceRegistration) bool {
+		return registration.Connect.Native && registration.Connect.SidecarService == nil
+	}), mock.Anything).Return(nil).Once()
+
+	agent := Agent{agentClient: mockAgentClient}
+
+	err := agent.Register([]ServiceInstance{{ID: "id", Name: "serviceName", Connect: &Connect{Native: true}}})
+
+	require.NoError(t, err)
+	mockAgentClient.AssertExpectations(t)
+}
+
+func TestIfFailsToRegisterNativeConnectServiceWithSidecar(t *testing.T) {
+	agent := Agent{agentClient: &MockAgentClient{}}
+
+	err := agent.Register([]ServiceInstance{{
+		ID:      "id",
+		Name:    "serviceName",
+		Connect: &Connect{Native: true, Sidecar: &SidecarProxy{}},
+	}})
+
+	require.EqualError(t, err, `Error registering service "serviceName" in Consul agent: native Connect service cannot have sidecar proxy`)
+}
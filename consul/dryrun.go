@@ -0,0 +1,96 @@
+package consul
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// dryRunRequest is a single agent request printed in dry-run mode.
+type dryRunRequest struct {
+	Action       string                        `json:"action"`
+	ServiceID    string                        `json:"serviceID,omitempty"`
+	Namespace    string                        `json:"namespace,omitempty"`
+	Reason       string                        `json:"reason,omitempty"`
+	Registration *api.AgentServiceRegistration `json:"registration,omitempty"`
+	// ReplaceExistingChecks is set when registration removes checks missing
+	// in it.
+	ReplaceExistingChecks bool `json:"replaceExistingChecks,omitempty"`
+}
+
+// dryRunClient prints requests as JSON instead of sending them to Consul agent.
+// Read-only requests are passed to the wrapped client, when present.
+type dryRunClient struct {
+	encoder *json.Encoder
+	reader  agentClient
+}
+
+func (c *dryRunClient) ServiceRegisterOpts(registration *api.AgentServiceRegistration, opts api.ServiceRegisterOpts) error {
+	return c.encoder.Encode(dryRunRequest{
+		Action:                "register",
+		ServiceID:             registration.ID,
+		Registration:          registration,
+		ReplaceExistingChecks: opts.ReplaceExistingChecks,
+	})
+}
+
+func (c *dryRunClient) ServiceDeregisterOpts(serviceID string, q *api.QueryOptions) error {
+	request := dryRunRequest{Action: "deregister", ServiceID: serviceID}
+	if q != nil {
+		request.Namespace = q.Namespace
+	}
+	return c.encoder.Encode(request)
+}
+
+func (c *dryRunClient) EnableServiceMaintenance(serviceID, reason string) error {
+	return c.encoder.Encode(dryRunRequest{Action: "enable-maintenance", ServiceID: serviceID, Reason: reason})
+}
+
+func (c *dryRunClient) DisableServiceMaintenance(serviceID string) error {
+	return c.encoder.Encode(dryRunRequest{Action: "disable-maintenance", ServiceID: serviceID})
+}
+
+func (c *dryRunClient) Services() (map[string]*api.AgentService, error) {
+	if c.reader != nil {
+		return c.reader.Services()
+	}
+	return map[string]*api.AgentService{}, nil
+}
+
+func (c *dryRunClient) ServicesWithFilterOpts(filter string, q *api.QueryOptions) (map[string]*api.AgentService, error) {
+	if c.reader != nil {
+		return c.reader.ServicesWithFilterOpts(filter, q)
+	}
+	return map[string]*api.AgentService{}, nil
+}
+
+func (c *dryRunClient) Checks() (map[string]*api.AgentCheck, error) {
+	if c.reader != nil {
+		return c.reader.Checks()
+	}
+	return map[string]*api.AgentCheck{}, nil
+}
+
+// NewDryRunAgent returns an Agent that writes requests it would send to Consul
+// agent as JSON to the passed writer, without contacting the agent.
+func NewDryRunAgent(w io.Writer) *Agent {
+	return &Agent{agentClient: newDryRunClient(w, nil), dryRun: true}
+}
+
+// DryRun returns an Agent that reads services from the same Consul agent, but
+// writes requests that would modify it as JSON to the passed writer. ACL token
+// is not checked, as dry-run must not depend on Consul ACL endpoints.
+func (a *Agent) DryRun(w io.Writer) *Agent {
+	return &Agent{
+		agentClient:        newDryRunClient(w, a.agentClient),
+		dryRun:             true,
+		keepExistingChecks: a.keepExistingChecks,
+	}
+}
+
+func newDryRunClient(w io.Writer, reader agentClient) *dryRunClient {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return &dryRunClient{encoder: encoder, reader: reader}
+}
@@ -0,0 +1,69 @@
+package consul
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIfPrintsRequestsInDryRun(t *testing.T) {
+	service := ServiceInstance{
+		ID:   "id",
+		Name: "serviceName",
+		Host: "myhost",
+		Port: 1234,
+		Tags: []string{"tag"},
+		Check: &Check{
+			Type:     CheckTCP,
+			Address:  "myhost:1234",
+			Interval: time.Second,
+			Timeout:  time.Second,
+		},
+	}
+
+	var output bytes.Buffer
+	agent := NewDryRunAgent(&output)
+
+	require.NoError(t, agent.Register([]ServiceInstance{service}))
+	require.NoError(t, agent.Drain([]ServiceInstance{service}, "reason", time.Hour))
+	require.NoError(t, agent.Deregister([]ServiceInstance{service}))
+
+	decoder := json.NewDecoder(&output)
+	var requests []dryRunRequest
+	for decoder.More() {
+		var request dryRunRequest
+		require.NoError(t, decoder.Decode(&request))
+		requests = append(requests, request)
+	}
+
+	require.Len(t, requests, 3)
+	assert.Equal(t, "register", requests[0].Action)
+	assert.True(t, requests[0].ReplaceExistingChecks)
+	assert.Equal(t, "myhost", requests[0].Registration.Address)
+	assert.Equal(t, []string{"tag"}, requests[0].Registration.Tags)
+	assert.Equal(t, "myhost:1234", requests[0].Registration.Check.TCP)
+	assert.Equal(t, dryRunRequest{Action: "enable-maintenance", ServiceID: "id", Reason: "reason"}, requests[1])
+	assert.Equal(t, dryRunRequest{Action: "deregister", ServiceID: "id"}, requests[2])
+}
+
+func TestIfReadsFromAgentInDryRun(t *testing.T) {
+	mockAgentClient := &MockAgentClient{}
+	mockAgentClient.On("Services").Return(map[string]*api.AgentService{
+		"id": {Service: "serviceName"},
+	}, nil).Once()
+
+	var output bytes.Buffer
+	agent := (&Agent{agentClient: mockAgentClient}).DryRun(&output)
+
+	services, err := agent.Find(ServiceSelector{Name: "serviceName"})
+	require.NoError(t, err)
+	require.NoError(t, agent.Deregister(services))
+
+	assert.Contains(t, output.String(), `"serviceID": "id"`)
+	mockAgentClient.AssertExpectations(t)
+}
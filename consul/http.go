@@ -0,0 +1,79 @@
+package consul
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// httpClient sends requests to Consul HTTP API endpoints not covered by the
+// API client. It uses address and HTTP client of already created API client.
+type httpClient struct {
+	config *api.Config
+}
+
+// responseError is returned when Consul responds with unexpected status.
+type responseError struct {
+	statusCode int
+	message    string
+}
+
+func (e *responseError) Error() string {
+	return fmt.Sprintf("unexpected response code %d (%s)", e.statusCode, e.message)
+}
+
+func (c *httpClient) do(method, path, token string, in, out interface{}) error {
+	return c.doInNamespace(c.config.Namespace, method, path, token, in, out)
+}
+
+// doInNamespace sends request scoped to the given namespace instead of the one
+// of the client, e.g. namespace of auth method instead of the services one.
+func (c *httpClient) doInNamespace(namespace, method, path, token string, in, out interface{}) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+
+	query := url.Values{}
+	if namespace != "" {
+		query.Set("ns", namespace)
+	}
+	if c.config.Partition != "" {
+		query.Set("partition", c.config.Partition)
+	}
+	endpoint := &url.URL{Scheme: c.config.Scheme, Host: c.config.Address, Path: path, RawQuery: query.Encode()}
+	req, err := http.NewRequest(method, endpoint.RequestURI(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.URL.Scheme = endpoint.Scheme
+	req.URL.Host = endpoint.Host
+	req.Host = endpoint.Host
+	if token != "" {
+		req.Header.Set("X-Consul-Token", token)
+	}
+
+	resp, err := c.config.HttpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return &responseError{statusCode: resp.StatusCode, message: strings.TrimSpace(string(message))}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,201 @@
+package consul
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/consul/api"
+)
+
+const (
+	defaultBearerTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+	aclLoginPath  = "/v1/acl/login"
+	aclLogoutPath = "/v1/acl/logout"
+
+	aclNotFoundMessage = "ACL not found"
+)
+
+// LoginConfig configures login with Consul ACL auth method.
+type LoginConfig struct {
+	// Method is a name of Kubernetes auth method configured in Consul.
+	Method string
+	// Namespace of the auth method, it is independent of the namespace
+	// services are registered in. Empty means the default namespace.
+	Namespace string
+	// BearerTokenFile contains service account JWT exchanged for ACL token,
+	// defaults to the token mounted in the pod.
+	BearerTokenFile string
+	// TokenFile stores ACL token obtained on login. When it exists, the stored
+	// token is used instead of logging in again, so it can be logged out by
+	// later hook call.
+	TokenFile string
+	// KeepToken requires TokenFile, as the token is not logged out by the hook
+	// call that obtained it (e.g. registration) but by a later one.
+	KeepToken bool
+	// Meta is attached to the ACL token.
+	Meta map[string]string
+}
+
+type loginRequest struct {
+	AuthMethod  string
+	BearerToken string
+	Meta        map[string]string `json:",omitempty"`
+}
+
+type loginResponse struct {
+	AccessorID string
+	SecretID   string
+}
+
+// loginSession is an ACL token obtained with auth method login.
+type loginSession struct {
+	client    *httpClient
+	namespace string
+	token     string
+	// stored is true when token is kept in tokenFile for later hook calls.
+	stored    bool
+	tokenFile string
+}
+
+// Login exchanges Kubernetes service account JWT for short-lived Consul ACL
+// token and returns Agent using it. Token file of agent config is ignored.
+func Login(agentConfig Config, config LoginConfig) (*Agent, error) {
+	if config.Method == "" {
+		return nil, errors.New("missing auth method name")
+	}
+	if config.KeepToken && config.TokenFile == "" {
+		return nil, errors.New("missing file to store ACL token in, it would never be logged out")
+	}
+
+	agentConfig.TokenFile = ""
+	apiConfig, err := agentConfig.apiConfig()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := api.NewClient(apiConfig); err != nil {
+		return nil, fmt.Errorf("unable to create Consul client: %s", err)
+	}
+	session := &loginSession{client: &httpClient{config: apiConfig}, namespace: config.Namespace, tokenFile: config.TokenFile}
+
+	if token := readStoredToken(config.TokenFile); token != "" {
+		if session.isExpired(token) {
+			log.Printf("Consul ACL token stored in %s expired, logging in again", config.TokenFile)
+		} else {
+			log.Printf("Using Consul ACL token stored in %s", config.TokenFile)
+			session.token = token
+			session.stored = true
+		}
+	}
+	if session.token == "" {
+		if err := session.login(config); err != nil {
+			return nil, err
+		}
+	}
+
+	apiConfig.Token = session.token
+	consulClient, err := api.NewClient(apiConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create Consul client: %s", err)
+	}
+	return &Agent{
+		agentClient:        consulClient.Agent(),
+		http:               session.client,
+		session:            session,
+		keepExistingChecks: agentConfig.KeepExistingChecks,
+	}, nil
+}
+
+func (s *loginSession) login(config LoginConfig) error {
+	bearerTokenFile := config.BearerTokenFile
+	if bearerTokenFile == "" {
+		bearerTokenFile = defaultBearerTokenFile
+	}
+	bearerToken, err := ioutil.ReadFile(bearerTokenFile)
+	if err != nil {
+		return fmt.Errorf("unable to read bearer token: %s", err)
+	}
+
+	log.Printf("Logging in to Consul with %q auth method", config.Method)
+	request := loginRequest{
+		AuthMethod:  config.Method,
+		BearerToken: strings.TrimSpace(string(bearerToken)),
+		Meta:        config.Meta,
+	}
+	response := loginResponse{}
+	if err := s.client.doInNamespace(s.namespace, http.MethodPost, aclLoginPath, "", request, &response); err != nil {
+		return fmt.Errorf("unable to login to Consul: %s", err)
+	}
+	if response.SecretID == "" {
+		return errors.New("unable to login to Consul: empty token in response")
+	}
+	s.token = response.SecretID
+
+	if s.tokenFile != "" {
+		if err := ioutil.WriteFile(s.tokenFile, []byte(s.token), 0600); err != nil {
+			return fmt.Errorf("unable to store Consul ACL token: %s", err)
+		}
+		s.stored = true
+	}
+	return nil
+}
+
+// isExpired returns true when Consul does not know the token anymore, e.g.
+// because it outlived max token TTL of the auth method. Token is considered
+// valid when it cannot be looked up for other reasons.
+func (s *loginSession) isExpired(token string) bool {
+	err := s.client.doInNamespace(s.namespace, http.MethodGet, aclTokenSelfPath, token, nil, &aclToken{})
+	respErr, ok := err.(*responseError)
+	return ok && respErr.statusCode == http.StatusForbidden && strings.Contains(respErr.message, aclNotFoundMessage)
+}
+
+func (s *loginSession) logout() error {
+	log.Print("Logging out from Consul")
+	if err := s.client.doInNamespace(s.namespace, http.MethodPost, aclLogoutPath, s.token, nil, nil); err != nil {
+		return fmt.Errorf("unable to logout from Consul: %s", err)
+	}
+	if s.stored {
+		if err := os.Remove(s.tokenFile); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("unable to remove stored Consul ACL token: %s", err)
+		}
+	}
+	return nil
+}
+
+// Logout destroys ACL token Agent logged in with, together with its stored
+// copy. It does nothing when Agent did not log in.
+func (a *Agent) Logout() error {
+	if a.session == nil {
+		return nil
+	}
+	if err := a.session.logout(); err != nil {
+		return err
+	}
+	a.session = nil
+	return nil
+}
+
+// Close destroys ACL token Agent logged in with, unless it is stored for later
+// hook calls.
+func (a *Agent) Close() error {
+	if a.session == nil || a.session.stored {
+		return nil
+	}
+	return a.Logout()
+}
+
+func readStoredToken(tokenFile string) string {
+	if tokenFile == "" {
+		return ""
+	}
+	token, err := ioutil.ReadFile(tokenFile)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(token))
+}
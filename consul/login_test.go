@@ -0,0 +1,176 @@
+package consul
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeACLServer struct {
+	logins  []loginRequest
+	logouts []string
+	queries []string
+}
+
+func (s *fakeACLServer) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	s.queries = append(s.queries, r.URL.Path+"?"+r.URL.RawQuery)
+	switch r.URL.Path {
+	case aclLoginPath:
+		request := loginRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.BearerToken != "jwt" {
+			rw.WriteHeader(http.StatusForbidden)
+			return
+		}
+		s.logins = append(s.logins, request)
+		json.NewEncoder(rw).Encode(loginResponse{AccessorID: "accessor", SecretID: "secret"})
+	case aclLogoutPath:
+		s.logouts = append(s.logouts, r.Header.Get("X-Consul-Token"))
+	case aclTokenSelfPath:
+		if r.Header.Get("X-Consul-Token") != "secret" {
+			rw.WriteHeader(http.StatusForbidden)
+			rw.Write([]byte(aclNotFoundMessage))
+			return
+		}
+		json.NewEncoder(rw).Encode(aclToken{AccessorID: "accessor"})
+	default:
+		rw.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func withFakeACLServer(t *testing.T) (*fakeACLServer, string) {
+	fake := &fakeACLServer{}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	address := os.Getenv(api.HTTPAddrEnvName)
+	os.Setenv(api.HTTPAddrEnvName, server.URL)
+	t.Cleanup(func() { os.Setenv(api.HTTPAddrEnvName, address) })
+
+	dir, err := ioutil.TempDir("", "login")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "jwt"), []byte("jwt\n"), 0600))
+
+	return fake, dir
+}
+
+func TestIfLogsInWithAuthMethod(t *testing.T) {
+	fake, dir := withFakeACLServer(t)
+
+	agent, err := Login(Config{}, LoginConfig{
+		Method:          "kubernetes",
+		BearerTokenFile: filepath.Join(dir, "jwt"),
+		Meta:            map[string]string{"pod": "default/pod"},
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, []loginRequest{{AuthMethod: "kubernetes", BearerToken: "jwt", Meta: map[string]string{"pod": "default/pod"}}}, fake.logins)
+	assert.Equal(t, "secret", agent.session.token)
+
+	require.NoError(t, agent.Close())
+	assert.Equal(t, []string{"secret"}, fake.logouts)
+}
+
+func TestIfReusesStoredTokenUntilLogout(t *testing.T) {
+	fake, dir := withFakeACLServer(t)
+	config := LoginConfig{
+		Method:          "kubernetes",
+		BearerTokenFile: filepath.Join(dir, "jwt"),
+		TokenFile:       filepath.Join(dir, "token"),
+	}
+
+	registerAgent, err := Login(Config{}, config)
+	require.NoError(t, err)
+	require.NoError(t, registerAgent.Close())
+
+	deregisterAgent, err := Login(Config{}, config)
+	require.NoError(t, err)
+
+	assert.Len(t, fake.logins, 1)
+	assert.Empty(t, fake.logouts)
+	assert.Equal(t, "secret", deregisterAgent.session.token)
+
+	require.NoError(t, deregisterAgent.Logout())
+	assert.Equal(t, []string{"secret"}, fake.logouts)
+	assert.NoFileExists(t, config.TokenFile)
+}
+
+func TestIfLogsInAgainWhenStoredTokenExpired(t *testing.T) {
+	fake, dir := withFakeACLServer(t)
+	config := LoginConfig{
+		Method:          "kubernetes",
+		BearerTokenFile: filepath.Join(dir, "jwt"),
+		TokenFile:       filepath.Join(dir, "token"),
+	}
+	require.NoError(t, ioutil.WriteFile(config.TokenFile, []byte("expired"), 0600))
+
+	agent, err := Login(Config{}, config)
+
+	require.NoError(t, err)
+	assert.Len(t, fake.logins, 1)
+	assert.Equal(t, "secret", agent.session.token)
+	token, err := ioutil.ReadFile(config.TokenFile)
+	require.NoError(t, err)
+	assert.Equal(t, "secret", string(token))
+
+	require.NoError(t, agent.Logout())
+	assert.Equal(t, []string{"secret"}, fake.logouts)
+}
+
+func TestIfFailsToLoginWithoutTokenFileWhenTokenIsKept(t *testing.T) {
+	fake, dir := withFakeACLServer(t)
+
+	_, err := Login(Config{}, LoginConfig{
+		Method:          "kubernetes",
+		BearerTokenFile: filepath.Join(dir, "jwt"),
+		KeepToken:       true,
+	})
+
+	assert.EqualError(t, err, "missing file to store ACL token in, it would never be logged out")
+	assert.Empty(t, fake.logins)
+}
+
+func TestIfLogsInToAuthMethodNamespaceInsteadOfServicesOne(t *testing.T) {
+	fake, dir := withFakeACLServer(t)
+	config := LoginConfig{Method: "kubernetes", BearerTokenFile: filepath.Join(dir, "jwt")}
+
+	agent, err := Login(Config{Namespace: "k8s-team"}, config)
+	require.NoError(t, err)
+	require.NoError(t, agent.Close())
+
+	config.Namespace = "auth"
+	agent, err = Login(Config{Namespace: "k8s-team", Partition: "apps"}, config)
+	require.NoError(t, err)
+	require.NoError(t, agent.Close())
+
+	assert.Equal(t, []string{
+		"/v1/acl/login?",
+		"/v1/acl/logout?",
+		"/v1/acl/login?ns=auth&partition=apps",
+		"/v1/acl/logout?ns=auth&partition=apps",
+	}, fake.queries)
+}
+
+func TestIfFailsToLoginWithInvalidBearerToken(t *testing.T) {
+	_, dir := withFakeACLServer(t)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "jwt"), []byte("invalid"), 0600))
+
+	_, err := Login(Config{}, LoginConfig{Method: "kubernetes", BearerTokenFile: filepath.Join(dir, "jwt")})
+
+	assert.EqualError(t, err, "unable to login to Consul: unexpected response code 403 ()")
+}
+
+func TestIfLogoutDoesNothingWithoutLogin(t *testing.T) {
+	agent := Agent{agentClient: &MockAgentClient{}}
+
+	assert.NoError(t, agent.Logout())
+	assert.NoError(t, agent.Close())
+}
@@ -0,0 +1,36 @@
+package consul
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIfScopesRequestsToNamespaceAndPartition(t *testing.T) {
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Path+"?"+r.URL.RawQuery)
+		if r.URL.Path == "/v1/agent/services" {
+			rw.Write([]byte("{}"))
+		}
+	}))
+	defer server.Close()
+
+	agent, err := NewAgent(Config{Address: server.URL, Namespace: "team", Partition: "apps"})
+	require.NoError(t, err)
+
+	services := []ServiceInstance{{ID: "id", Name: "name"}}
+	require.NoError(t, agent.Register(services))
+	require.NoError(t, agent.Deregister(services))
+	_, err = agent.Services()
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"/v1/agent/service/register?ns=team&partition=apps&replace-existing-checks=true",
+		"/v1/agent/service/deregister/id?ns=team&partition=apps",
+		"/v1/agent/services?ns=team&partition=apps",
+	}, queries)
+}
@@ -0,0 +1,122 @@
+package consul
+
+import (
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// allNamespaces is a wildcard selecting services of all Consul Enterprise
+// namespaces.
+const allNamespaces = "*"
+
+// ServiceSelector selects services registered in Consul agent. Empty fields
+// match any service.
+type ServiceSelector struct {
+	Name string
+	// Tag is a glob pattern (e.g. "instance:pod_*") matched against each tag.
+	Tag     string
+	Address string
+	Port    int
+}
+
+// IsEmpty returns true when selector matches every service.
+func (s ServiceSelector) IsEmpty() bool {
+	return s == ServiceSelector{}
+}
+
+// Validate returns an error when selector is malformed.
+func (s ServiceSelector) Validate() error {
+	if _, err := path.Match(s.Tag, ""); err != nil {
+		return fmt.Errorf("invalid tag pattern %q: %s", s.Tag, err)
+	}
+	return nil
+}
+
+func (s ServiceSelector) matches(service ServiceInstance) bool {
+	if s.Name != "" && s.Name != service.Name {
+		return false
+	}
+	if s.Address != "" && s.Address != service.Host {
+		return false
+	}
+	if s.Port != 0 && s.Port != service.Port {
+		return false
+	}
+	if s.Tag == "" {
+		return true
+	}
+	for _, tag := range service.Tags {
+		if matched, _ := path.Match(s.Tag, tag); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Services returns all services registered in Consul agent, sorted by ID.
+func (a *Agent) Services() ([]ServiceInstance, error) {
+	registered, err := a.agentClient.Services()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get services from Consul agent: %s", err)
+	}
+	return toServiceInstances(registered), nil
+}
+
+// ServicesInAllNamespaces returns services registered in Consul agent in all
+// Consul Enterprise namespaces, sorted by namespace and ID.
+func (a *Agent) ServicesInAllNamespaces() ([]ServiceInstance, error) {
+	registered, err := a.agentClient.ServicesWithFilterOpts("", &api.QueryOptions{Namespace: allNamespaces})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get services from Consul agent: %s", err)
+	}
+	return toServiceInstances(registered), nil
+}
+
+func toServiceInstances(registered map[string]*api.AgentService) []ServiceInstance {
+	services := make([]ServiceInstance, 0, len(registered))
+	for id, service := range registered {
+		instance := ServiceInstance{
+			ID:        id,
+			Name:      service.Service,
+			Host:      service.Address,
+			Port:      service.Port,
+			Tags:      service.Tags,
+			Namespace: service.Namespace,
+		}
+		if service.Kind == api.ServiceKindConnectProxy && service.Proxy != nil &&
+			id == sidecarProxyID(service.Proxy.DestinationServiceID) {
+			instance.SidecarFor = service.Proxy.DestinationServiceID
+		}
+		services = append(services, instance)
+	}
+	sort.Slice(services, func(i, j int) bool {
+		if services[i].Namespace != services[j].Namespace {
+			return services[i].Namespace < services[j].Namespace
+		}
+		return services[i].ID < services[j].ID
+	})
+	return services
+}
+
+// Find returns services registered in Consul agent matching the selector.
+func (a *Agent) Find(selector ServiceSelector) ([]ServiceInstance, error) {
+	if err := selector.Validate(); err != nil {
+		return nil, err
+	}
+
+	services, err := a.Services()
+	if err != nil {
+		return nil, err
+	}
+
+	var matching []ServiceInstance
+	for _, service := range services {
+		if selector.matches(service) {
+			matching = append(matching, service)
+		}
+	}
+	return matching, nil
+}
@@ -0,0 +1,50 @@
+package consul
+
+import (
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIfFindsServicesMatchingSelector(t *testing.T) {
+	mockAgentClient := &MockAgentClient{}
+	mockAgentClient.On("Services").Return(map[string]*api.AgentService{
+		"192.0.2.2_8080": {Service: "a", Address: "192.0.2.2", Port: 8080, Tags: []string{"instance:pod-1_8080"}},
+		"192.0.2.2_8081": {Service: "b", Address: "192.0.2.2", Port: 8081, Tags: []string{"instance:pod-1_8081"}},
+		"192.0.2.3_8080": {Service: "a", Address: "192.0.2.3", Port: 8080, Tags: []string{"instance:pod-2_8080"}},
+	}, nil)
+
+	agent := Agent{agentClient: mockAgentClient}
+
+	testCases := []struct {
+		selector    ServiceSelector
+		expectedIDs []string
+	}{
+		{ServiceSelector{Name: "a"}, []string{"192.0.2.2_8080", "192.0.2.3_8080"}},
+		{ServiceSelector{Tag: "instance:pod-1_*"}, []string{"192.0.2.2_8080", "192.0.2.2_8081"}},
+		{ServiceSelector{Address: "192.0.2.2", Port: 8081}, []string{"192.0.2.2_8081"}},
+		{ServiceSelector{Name: "a", Tag: "instance:pod-1_*"}, []string{"192.0.2.2_8080"}},
+		{ServiceSelector{Name: "c"}, nil},
+	}
+
+	for _, testCase := range testCases {
+		services, err := agent.Find(testCase.selector)
+
+		require.NoError(t, err)
+		var ids []string
+		for _, service := range services {
+			ids = append(ids, service.ID)
+		}
+		assert.Equal(t, testCase.expectedIDs, ids, "%+v", testCase.selector)
+	}
+}
+
+func TestIfRejectsMalformedTagPattern(t *testing.T) {
+	agent := Agent{agentClient: &MockAgentClient{}}
+
+	_, err := agent.Find(ServiceSelector{Tag: "instance:["})
+
+	require.Error(t, err)
+}
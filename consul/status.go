@@ -0,0 +1,262 @@
+package consul
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// StatusState describes how a service instance registered in Consul agent
+// relates to the desired one.
+type StatusState string
+
+const (
+	// StatusOK represents service registered exactly as desired.
+	StatusOK = StatusState("ok")
+	// StatusMissing represents desired service not registered in agent.
+	StatusMissing = StatusState("missing")
+	// StatusExtra represents service registered in agent that is not desired.
+	StatusExtra = StatusState("extra")
+	// StatusMismatch represents service registered differently than desired.
+	StatusMismatch = StatusState("mismatch")
+)
+
+// ServiceStatus is a result of comparing desired service instance with the one
+// registered in Consul agent.
+type ServiceStatus struct {
+	ID         string      `json:"id"`
+	Name       string      `json:"name"`
+	State      StatusState `json:"state"`
+	Health     string      `json:"health,omitempty"`
+	Mismatches []string    `json:"mismatches,omitempty"`
+}
+
+// Status compares desired service instances with services registered in Consul
+// agent. Registered services that are not desired but match any of the owner
+// selectors are reported as extra.
+func (a *Agent) Status(services []ServiceInstance, owners []ServiceSelector) ([]ServiceStatus, error) {
+	registered, err := a.agentClient.Services()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get services from Consul agent: %s", err)
+	}
+	checks, err := a.agentClient.Checks()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get checks from Consul agent: %s", err)
+	}
+
+	serviceChecks := make(map[string]api.HealthChecks)
+	for _, check := range checks {
+		serviceChecks[check.ServiceID] = append(serviceChecks[check.ServiceID], &api.HealthCheck{
+			CheckID:    check.CheckID,
+			Status:     check.Status,
+			ServiceID:  check.ServiceID,
+			Definition: check.Definition,
+		})
+	}
+
+	var statuses []ServiceStatus
+	desired := make(map[string]bool)
+	for _, service := range services {
+		desired[service.ID] = true
+		if service.Connect != nil && service.Connect.Sidecar != nil {
+			// Sidecar proxy inherits tags of the service, but it is not
+			// compared with the desired one.
+			desired[sidecarProxyID(service.ID)] = true
+		}
+		status := ServiceStatus{ID: service.ID, Name: service.Name, State: StatusOK}
+
+		actual, ok := registered[service.ID]
+		if !ok {
+			status.State = StatusMissing
+			statuses = append(statuses, status)
+			continue
+		}
+
+		status.Health = serviceChecks[service.ID].AggregatedStatus()
+		status.Mismatches = compareService(service, actual, serviceChecks[service.ID])
+		status.Mismatches = append(status.Mismatches, compareSidecar(service, registered)...)
+		if len(status.Mismatches) > 0 {
+			status.State = StatusMismatch
+		}
+		statuses = append(statuses, status)
+	}
+
+	for id, actual := range registered {
+		if desired[id] || !isOwned(actual, owners) {
+			continue
+		}
+		statuses = append(statuses, ServiceStatus{
+			ID:     id,
+			Name:   actual.Service,
+			State:  StatusExtra,
+			Health: serviceChecks[id].AggregatedStatus(),
+		})
+	}
+
+	sort.SliceStable(statuses, func(i, j int) bool {
+		return statuses[i].ID < statuses[j].ID
+	})
+
+	return statuses, nil
+}
+
+// HasDrift returns true when any of statuses differs from the desired state.
+func HasDrift(statuses []ServiceStatus) bool {
+	for _, status := range statuses {
+		if status.State != StatusOK {
+			return true
+		}
+	}
+	return false
+}
+
+func compareService(service ServiceInstance, actual *api.AgentService, checks api.HealthChecks) []string {
+	var mismatches []string
+
+	if service.Name != actual.Service {
+		mismatches = append(mismatches, fmt.Sprintf("name: want %q, got %q", service.Name, actual.Service))
+	}
+	if service.Host != actual.Address {
+		mismatches = append(mismatches, fmt.Sprintf("address: want %q, got %q", service.Host, actual.Address))
+	}
+	if service.Port != actual.Port {
+		mismatches = append(mismatches, fmt.Sprintf("port: want %d, got %d", service.Port, actual.Port))
+	}
+	missing, extra := diffTags(service.Tags, actual.Tags)
+	if len(missing) > 0 {
+		mismatches = append(mismatches, fmt.Sprintf("missing tags: %s", strings.Join(missing, ", ")))
+	}
+	if len(extra) > 0 {
+		mismatches = append(mismatches, fmt.Sprintf("extra tags: %s", strings.Join(extra, ", ")))
+	}
+	mismatches = append(mismatches, compareMeta(service.Meta, actual.Meta)...)
+	mismatches = append(mismatches, compareTaggedAddresses(service.TaggedAddresses, actual.TaggedAddresses)...)
+	wantNative := service.Connect != nil && service.Connect.Native
+	if gotNative := actual.Connect != nil && actual.Connect.Native; wantNative != gotNative {
+		mismatches = append(mismatches, fmt.Sprintf("connect native: want %t, got %t", wantNative, gotNative))
+	}
+
+	var definitions []api.HealthCheckDefinition
+	for _, check := range checks {
+		if !strings.HasPrefix(check.CheckID, api.ServiceMaintPrefix) {
+			definitions = append(definitions, check.Definition)
+		}
+	}
+	expected := len(service.Checks)
+	if service.Check != nil {
+		expected++
+	}
+	switch {
+	case expected > 0 && len(definitions) == 0:
+		mismatches = append(mismatches, "check: missing")
+	case expected == 0 && len(definitions) > 0:
+		mismatches = append(mismatches, "check: not expected")
+	case expected != len(definitions):
+		mismatches = append(mismatches, fmt.Sprintf("checks: want %d, got %d", expected, len(definitions)))
+	case expected == 1 && service.Check != nil:
+		if address := definitions[0].HTTP + definitions[0].TCP; address != "" && address != service.Check.Address {
+			mismatches = append(mismatches, fmt.Sprintf("check: want %q, got %q", service.Check.Address, address))
+		}
+	}
+
+	return mismatches
+}
+
+func diffTags(want, got []string) (missing, extra []string) {
+	gotSet := make(map[string]bool, len(got))
+	for _, tag := range got {
+		gotSet[tag] = true
+	}
+	wantSet := make(map[string]bool, len(want))
+	for _, tag := range want {
+		wantSet[tag] = true
+		if !gotSet[tag] {
+			missing = append(missing, tag)
+		}
+	}
+	for _, tag := range got {
+		if !wantSet[tag] {
+			extra = append(extra, tag)
+		}
+	}
+	return missing, extra
+}
+
+func compareMeta(want, got map[string]string) []string {
+	var mismatches []string
+	for _, key := range sortedKeys(want) {
+		if value, ok := got[key]; !ok || value != want[key] {
+			mismatches = append(mismatches, fmt.Sprintf("meta %s: want %q, got %q", key, want[key], value))
+		}
+	}
+	var extra []string
+	for _, key := range sortedKeys(got) {
+		if _, ok := want[key]; !ok {
+			extra = append(extra, key)
+		}
+	}
+	if len(extra) > 0 {
+		mismatches = append(mismatches, fmt.Sprintf("extra meta: %s", strings.Join(extra, ", ")))
+	}
+	return mismatches
+}
+
+// compareTaggedAddresses compares only desired tagged addresses, as Consul
+// agent adds default ones (e.g. lan_ipv4) to registered services.
+func compareTaggedAddresses(want map[string]ServiceAddress, got map[string]api.ServiceAddress) []string {
+	keys := make([]string, 0, len(want))
+	for key := range want {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var mismatches []string
+	for _, key := range keys {
+		actual, ok := got[key]
+		switch {
+		case !ok:
+			mismatches = append(mismatches, fmt.Sprintf("tagged address %s: missing", key))
+		case actual.Address != want[key].Address || actual.Port != want[key].Port:
+			mismatches = append(mismatches, fmt.Sprintf("tagged address %s: want %s:%d, got %s:%d",
+				key, want[key].Address, want[key].Port, actual.Address, actual.Port))
+		}
+	}
+	return mismatches
+}
+
+// compareSidecar checks whether sidecar proxy of the service is registered
+// when desired.
+func compareSidecar(service ServiceInstance, registered map[string]*api.AgentService) []string {
+	want := service.Connect != nil && service.Connect.Sidecar != nil
+	_, got := registered[sidecarProxyID(service.ID)]
+	switch {
+	case want && !got:
+		return []string{"sidecar proxy: missing"}
+	case !want && got:
+		return []string{"sidecar proxy: not expected"}
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// isOwned returns true when registered service matches any of non-empty owner
+// selectors.
+func isOwned(actual *api.AgentService, owners []ServiceSelector) bool {
+	service := ServiceInstance{Name: actual.Service, Host: actual.Address, Port: actual.Port, Tags: actual.Tags}
+	for _, owner := range owners {
+		if !owner.IsEmpty() && owner.matches(service) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+package consul
+
+import (
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIfReportsRegistrationDrift(t *testing.T) {
+	services := []ServiceInstance{
+		{ID: "ok", Name: "service", Host: "192.0.2.2", Port: 8080, Tags: []string{"owner"},
+			Check: &Check{Type: CheckHTTPGet, Address: "http://192.0.2.2:8080/status"}},
+		{ID: "missing", Name: "service", Host: "192.0.2.2", Port: 8081},
+		{ID: "mismatch", Name: "service", Host: "192.0.2.2", Port: 8082, Tags: []string{"owner", "a"}},
+	}
+
+	mockAgentClient := &MockAgentClient{}
+	mockAgentClient.On("Services").Return(map[string]*api.AgentService{
+		"ok":       {ID: "ok", Service: "service", Address: "192.0.2.2", Port: 8080, Tags: []string{"owner"}},
+		"mismatch": {ID: "mismatch", Service: "service", Address: "192.0.2.2", Port: 9090, Tags: []string{"owner", "b"}},
+		"extra":    {ID: "extra", Service: "service", Tags: []string{"owner"}},
+		"foreign":  {ID: "foreign", Service: "other"},
+	}, nil).Once()
+	mockAgentClient.On("Checks").Return(map[string]*api.AgentCheck{
+		"service:ok": {CheckID: "service:ok", ServiceID: "ok", Status: api.HealthPassing,
+			Definition: api.HealthCheckDefinition{HTTP: "http://192.0.2.2:8080/status"}},
+		"_service_maintenance:mismatch": {CheckID: "_service_maintenance:mismatch", ServiceID: "mismatch", Status: api.HealthCritical},
+	}, nil).Once()
+
+	agent := Agent{agentClient: mockAgentClient}
+
+	statuses, err := agent.Status(services, []ServiceSelector{{Tag: "owner"}})
+
+	require.NoError(t, err)
+	require.Len(t, statuses, 4)
+	assert.Equal(t, ServiceStatus{ID: "extra", Name: "service", State: StatusExtra, Health: api.HealthPassing}, statuses[0])
+	assert.Equal(t, StatusMismatch, statuses[1].State)
+	assert.Equal(t, api.HealthMaint, statuses[1].Health)
+	assert.Equal(t, []string{"port: want 8082, got 9090", "missing tags: a", "extra tags: b"}, statuses[1].Mismatches)
+	assert.Equal(t, StatusMissing, statuses[2].State)
+	assert.Equal(t, ServiceStatus{ID: "ok", Name: "service", State: StatusOK, Health: api.HealthPassing}, statuses[3])
+	assert.True(t, HasDrift(statuses))
+	mockAgentClient.AssertExpectations(t)
+}
+
+func TestIfReportsNoDriftWhenRegisteredAsDesired(t *testing.T) {
+	services := []ServiceInstance{
+		{ID: "ok", Name: "service", Host: "192.0.2.2", Port: 8080},
+	}
+
+	mockAgentClient := &MockAgentClient{}
+	mockAgentClient.On("Services").Return(map[string]*api.AgentService{
+		"ok": {ID: "ok", Service: "service", Address: "192.0.2.2", Port: 8080},
+	}, nil).Once()
+	mockAgentClient.On("Checks").Return(map[string]*api.AgentCheck{}, nil).Once()
+
+	agent := Agent{agentClient: mockAgentClient}
+
+	statuses, err := agent.Status(services, nil)
+
+	require.NoError(t, err)
+	assert.False(t, HasDrift(statuses))
+}
+
+func TestIfReportsExtraServicesWithOwnedName(t *testing.T) {
+	services := []ServiceInstance{
+		{ID: "ok", Name: "service", Host: "192.0.2.2", Port: 8080},
+	}
+
+	mockAgentClient := &MockAgentClient{}
+	mockAgentClient.On("Services").Return(map[string]*api.AgentService{
+		"ok":      {ID: "ok", Service: "service", Address: "192.0.2.2", Port: 8080},
+		"extra":   {ID: "extra", Service: "service", Address: "192.0.2.3", Port: 8080},
+		"foreign": {ID: "foreign", Service: "other"},
+	}, nil).Once()
+	mockAgentClient.On("Checks").Return(map[string]*api.AgentCheck{}, nil).Once()
+
+	agent := Agent{agentClient: mockAgentClient}
+
+	statuses, err := agent.Status(services, []ServiceSelector{{Name: "service"}, {}})
+
+	require.NoError(t, err)
+	require.Len(t, statuses, 2)
+	assert.Equal(t, ServiceStatus{ID: "extra", Name: "service", State: StatusExtra, Health: api.HealthPassing}, statuses[0])
+	assert.Equal(t, StatusOK, statuses[1].State)
+}
+
+func TestIfReportsMetaTaggedAddressesAndConnectDrift(t *testing.T) {
+	services := []ServiceInstance{
+		{ID: "meta", Name: "service", Meta: map[string]string{"version": "2", "zone": "a"}},
+		{ID: "wan", Name: "service", TaggedAddresses: map[string]ServiceAddress{
+			TaggedAddressWAN:     {Address: "198.51.100.2", Port: 30080},
+			TaggedAddressVirtual: {Address: "240.0.0.1", Port: 80},
+		}},
+		{ID: "sidecar", Name: "service", Connect: &Connect{Sidecar: &SidecarProxy{}}},
+		{ID: "native", Name: "service", Connect: &Connect{Native: true}},
+	}
+
+	mockAgentClient := &MockAgentClient{}
+	mockAgentClient.On("Services").Return(map[string]*api.AgentService{
+		"meta": {ID: "meta", Service: "service", Meta: map[string]string{"version": "1", "extra": "x"}},
+		"wan": {ID: "wan", Service: "service", TaggedAddresses: map[string]api.ServiceAddress{
+			TaggedAddressWAN:     {Address: "198.51.100.2", Port: 8080},
+			TaggedAddressLANIPv4: {Address: "192.0.2.2", Port: 8080},
+		}},
+		"sidecar":              {ID: "sidecar", Service: "service"},
+		"native":               {ID: "native", Service: "service"},
+		"native-sidecar-proxy": {ID: "native-sidecar-proxy", Service: "service-sidecar-proxy", Kind: api.ServiceKindConnectProxy},
+	}, nil).Once()
+	mockAgentClient.On("Checks").Return(map[string]*api.AgentCheck{}, nil).Once()
+
+	agent := Agent{agentClient: mockAgentClient}
+
+	statuses, err := agent.Status(services, nil)
+
+	require.NoError(t, err)
+	require.Len(t, statuses, 4)
+	assert.Equal(t, []string{`meta version: want "2", got "1"`, `meta zone: want "a", got ""`, "extra meta: extra"}, statuses[0].Mismatches)
+	assert.Equal(t, []string{"connect native: want true, got false", "sidecar proxy: not expected"}, statuses[1].Mismatches)
+	assert.Equal(t, []string{"sidecar proxy: missing"}, statuses[2].Mismatches)
+	assert.Equal(t, []string{"tagged address virtual: missing", "tagged address wan: want 198.51.100.2:30080, got 198.51.100.2:8080"}, statuses[3].Mismatches)
+}
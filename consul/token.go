@@ -0,0 +1,92 @@
+package consul
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const (
+	aclTokenSelfPath = "/v1/acl/token/self"
+	aclAuthorizePath = "/v1/internal/acl/authorize"
+
+	aclDisabledMessage = "ACL support disabled"
+)
+
+type aclToken struct {
+	AccessorID  string
+	Description string
+}
+
+type authorization struct {
+	Resource string
+	Segment  string
+	Access   string
+	Allow    bool `json:",omitempty"`
+}
+
+// CheckToken looks up ACL token used by Agent and verifies that it grants
+// service:write permission for passed services, so registration does not fail
+// halfway. Permissions are not verified when Consul does not support it.
+func (a *Agent) CheckToken(services []ServiceInstance) error {
+	if a.http == nil {
+		return nil
+	}
+	token := a.http.config.Token
+
+	self := aclToken{}
+	err := a.http.do(http.MethodGet, aclTokenSelfPath, token, nil, &self)
+	if respErr, ok := err.(*responseError); ok && respErr.statusCode == http.StatusUnauthorized && strings.Contains(respErr.message, aclDisabledMessage) {
+		log.Print("ACLs are disabled in Consul, skipping token check")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to look up Consul ACL token: %s", err)
+	}
+	log.Printf("Using Consul ACL token %s (%s)", self.AccessorID, self.Description)
+
+	var requests []authorization
+	for _, name := range serviceNames(services) {
+		requests = append(requests, authorization{Resource: "service", Segment: name, Access: "write"})
+	}
+	if len(requests) == 0 {
+		return nil
+	}
+
+	var results []authorization
+	err = a.http.do(http.MethodPost, aclAuthorizePath, token, requests, &results)
+	if respErr, ok := err.(*responseError); ok && respErr.statusCode == http.StatusNotFound {
+		log.Print("Consul does not support checking token permissions, skipping it")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to check Consul ACL token permissions: %s", err)
+	}
+
+	var denied []string
+	for _, result := range results {
+		if !result.Allow {
+			denied = append(denied, result.Segment)
+		}
+	}
+	if len(denied) > 0 {
+		return fmt.Errorf("Consul ACL token %s lacks service:write permission for services: %s", self.AccessorID, strings.Join(denied, ", "))
+	}
+	return nil
+}
+
+// serviceNames returns sorted, unique names of passed services.
+func serviceNames(services []ServiceInstance) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, service := range services {
+		if service.Name != "" && !seen[service.Name] {
+			seen[service.Name] = true
+			names = append(names, service.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
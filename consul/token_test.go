@@ -0,0 +1,100 @@
+package consul
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTokenCheckAgent(t *testing.T, handler http.HandlerFunc) *Agent {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	config := &api.Config{Address: server.URL, Token: "secret"}
+	_, err := api.NewClient(config)
+	require.NoError(t, err)
+
+	return &Agent{agentClient: &MockAgentClient{}, http: &httpClient{config: config}}
+}
+
+func TestIfReportsMissingServiceWritePermissions(t *testing.T) {
+	var requests []authorization
+	agent := newTokenCheckAgent(t, func(rw http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Consul-Token") != "secret" {
+			rw.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case aclTokenSelfPath:
+			json.NewEncoder(rw).Encode(aclToken{AccessorID: "accessor", Description: "hook"})
+		case aclAuthorizePath:
+			json.NewDecoder(r.Body).Decode(&requests)
+			results := make([]authorization, len(requests))
+			for i, request := range requests {
+				results[i] = request
+				results[i].Allow = request.Segment == "allowed"
+			}
+			json.NewEncoder(rw).Encode(results)
+		}
+	})
+
+	err := agent.CheckToken([]ServiceInstance{{Name: "denied"}, {Name: "allowed"}, {Name: "denied"}})
+
+	assert.EqualError(t, err, "Consul ACL token accessor lacks service:write permission for services: denied")
+	assert.Equal(t, []authorization{
+		{Resource: "service", Segment: "allowed", Access: "write"},
+		{Resource: "service", Segment: "denied", Access: "write"},
+	}, requests)
+}
+
+func TestIfFailsTokenCheckWhenTokenIsNotFound(t *testing.T) {
+	agent := newTokenCheckAgent(t, func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusForbidden)
+		rw.Write([]byte("ACL not found"))
+	})
+
+	err := agent.CheckToken([]ServiceInstance{{Name: "service"}})
+
+	assert.EqualError(t, err, "unable to look up Consul ACL token: unexpected response code 403 (ACL not found)")
+}
+
+func TestIfSkipsTokenCheckWhenNotSupported(t *testing.T) {
+	for _, handler := range []http.HandlerFunc{
+		func(rw http.ResponseWriter, r *http.Request) {
+			rw.WriteHeader(http.StatusUnauthorized)
+			rw.Write([]byte("ACL support disabled"))
+		},
+		func(rw http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == aclTokenSelfPath {
+				json.NewEncoder(rw).Encode(aclToken{AccessorID: "accessor"})
+				return
+			}
+			rw.WriteHeader(http.StatusNotFound)
+		},
+	} {
+		agent := newTokenCheckAgent(t, handler)
+
+		err := agent.CheckToken([]ServiceInstance{{Name: "service"}})
+
+		assert.NoError(t, err)
+	}
+}
+
+func TestIfSkipsTokenCheckInDryRun(t *testing.T) {
+	requested := false
+	agent := newTokenCheckAgent(t, func(rw http.ResponseWriter, r *http.Request) {
+		requested = true
+		rw.WriteHeader(http.StatusForbidden)
+	})
+
+	err := agent.DryRun(ioutil.Discard).CheckToken([]ServiceInstance{{Name: "service"}})
+
+	assert.NoError(t, err)
+	assert.False(t, requested)
+}
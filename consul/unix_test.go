@@ -0,0 +1,58 @@
+package consul
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIfConnectsToAgentOverUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "consul")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "consul.sock")
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+
+	registered := map[string]*api.AgentService{}
+	server := &http.Server{Handler: http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/agent/service/register":
+			registration := api.AgentServiceRegistration{}
+			json.NewDecoder(r.Body).Decode(&registration)
+			registered[registration.ID] = &api.AgentService{ID: registration.ID, Service: registration.Name}
+		case "/v1/agent/services":
+			json.NewEncoder(rw).Encode(registered)
+		case aclTokenSelfPath:
+			rw.WriteHeader(http.StatusUnauthorized)
+			rw.Write([]byte(aclDisabledMessage))
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	agent, err := NewAgent(Config{Address: "unix://" + socket})
+	require.NoError(t, err)
+
+	services := []ServiceInstance{{ID: "id", Name: "name"}}
+	require.NoError(t, agent.CheckToken(services))
+	require.NoError(t, agent.Register(services))
+
+	registeredServices, err := agent.Services()
+
+	require.NoError(t, err)
+	require.Len(t, registeredServices, 1)
+	assert.Equal(t, "id", registeredServices[0].ID)
+	assert.Equal(t, "name", registeredServices[0].Name)
+}
@@ -0,0 +1,366 @@
+package hookflags
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/allegro/consul-registration-hook/consul"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// serviceDefinitionFile follows Consul service definition format, accepting
+// both single service and multiple services forms. Like in Consul, keys are
+// matched ignoring case and underscores, so both CamelCase (e.g.
+// DeregisterCriticalServiceAfter) and snake_case (e.g.
+// deregister_critical_service_after) forms are accepted.
+type serviceDefinitionFile struct {
+	Service  *serviceDefinition
+	Services []serviceDefinition
+}
+
+type serviceDefinition struct {
+	ID              string
+	Name            string
+	Tags            []string
+	Address         string
+	Port            int
+	TaggedAddresses map[string]serviceAddress
+	Meta            map[string]string
+	Weights         *weights
+	Connect         *connect
+	Check           *checkDefinition
+	Checks          []checkDefinition
+}
+
+type serviceAddress struct {
+	Address string
+	Port    int
+}
+
+type connect struct {
+	Native bool
+}
+
+type weights struct {
+	Passing int
+	Warning int
+}
+
+type checkDefinition struct {
+	Name                           string
+	HTTP                           string
+	Method                         string
+	Header                         map[string][]string
+	TLSSkipVerify                  bool
+	TCP                            string
+	GRPC                           string
+	GRPCUseTLS                     bool
+	H2Ping                         string
+	H2PingUseTLS                   bool
+	TTL                            duration
+	Args                           []string
+	Interval                       duration
+	Timeout                        duration
+	DeregisterCriticalServiceAfter duration
+}
+
+// userKeyFields hold maps with keys defined by user, which are not normalized.
+var userKeyFields = map[string]bool{"meta": true, "header": true}
+
+// normalizeKeys removes underscores from keys of definition objects, so
+// snake_case keys match CamelCase field names. Keys of tagged addresses, meta
+// and headers are kept intact. Original keys are collected in originals, so
+// errors can refer to them.
+func normalizeKeys(value interface{}, originals map[string]string) (interface{}, error) {
+	switch v := value.(type) {
+	case []interface{}:
+		for i := range v {
+			normalized, err := normalizeKeys(v[i], originals)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = normalized
+		}
+		return v, nil
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		seen := make(map[string]string, len(v))
+		for key, child := range v {
+			normalizedKey := strings.ReplaceAll(key, "_", "")
+			field := strings.ToLower(normalizedKey)
+			if other, ok := seen[field]; ok {
+				return nil, fmt.Errorf("duplicated keys %q and %q", other, key)
+			}
+			seen[field] = key
+			originals[normalizedKey] = key
+
+			switch {
+			case userKeyFields[field]:
+			case field == "taggedaddresses":
+				if addresses, ok := child.(map[string]interface{}); ok {
+					for name, address := range addresses {
+						normalized, err := normalizeKeys(address, originals)
+						if err != nil {
+							return nil, err
+						}
+						addresses[name] = normalized
+					}
+				}
+			default:
+				normalized, err := normalizeKeys(child, originals)
+				if err != nil {
+					return nil, err
+				}
+				child = normalized
+			}
+			result[normalizedKey] = child
+		}
+		return result, nil
+	}
+	return value, nil
+}
+
+// duration is a time.Duration unmarshalled from Go duration string.
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("duration should be a string like \"10s\": %s", data)
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = duration(parsed)
+	return nil
+}
+
+// LoadServiceDefinitions reads services to register from a YAML or JSON file
+// in Consul service definition format.
+func LoadServiceDefinitions(path string) ([]consul.ServiceInstance, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read service definition file: %s", err)
+	}
+
+	services, err := parseServiceDefinitions(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid service definition file %s: %s", path, err)
+	}
+	return services, nil
+}
+
+func parseServiceDefinitions(data []byte) ([]consul.ServiceInstance, error) {
+	jsonData, err := yaml.ToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw interface{}
+	if err := json.Unmarshal(jsonData, &raw); err != nil {
+		return nil, err
+	}
+	originals := make(map[string]string)
+	normalized, err := normalizeKeys(raw, originals)
+	if err != nil {
+		return nil, err
+	}
+	jsonData, err = json.Marshal(normalized)
+	if err != nil {
+		return nil, err
+	}
+
+	file := serviceDefinitionFile{}
+	decoder := json.NewDecoder(bytes.NewReader(jsonData))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return nil, withOriginalKeys(err, originals)
+	}
+
+	definitions := file.Services
+	if file.Service != nil {
+		definitions = append([]serviceDefinition{*file.Service}, definitions...)
+	}
+	if len(definitions) == 0 {
+		return nil, errors.New("no services defined, expected \"service\" or \"services\" key")
+	}
+
+	var services []consul.ServiceInstance
+	ids := make(map[string]bool)
+	for idx, definition := range definitions {
+		service, err := definition.toServiceInstance()
+		if err != nil {
+			return nil, fmt.Errorf("service %d (%q): %s", idx, definition.Name, err)
+		}
+		if ids[service.ID] {
+			return nil, fmt.Errorf("service %d (%q): duplicated id %q", idx, definition.Name, service.ID)
+		}
+		ids[service.ID] = true
+		services = append(services, service)
+	}
+	return services, nil
+}
+
+// withOriginalKeys replaces normalized key in unknown field error with the key
+// used in the file.
+func withOriginalKeys(err error, originals map[string]string) error {
+	const prefix = "json: unknown field "
+	message := err.Error()
+	if !strings.HasPrefix(message, prefix) {
+		return err
+	}
+	key, unquoteErr := strconv.Unquote(strings.TrimPrefix(message, prefix))
+	if unquoteErr != nil {
+		return err
+	}
+	if original, ok := originals[key]; ok {
+		key = original
+	}
+	return fmt.Errorf("unsupported field %q", key)
+}
+
+func (d serviceDefinition) toServiceInstance() (consul.ServiceInstance, error) {
+	if d.Name == "" {
+		return consul.ServiceInstance{}, errors.New("missing name")
+	}
+	if d.Port < 0 || d.Port > 65535 {
+		return consul.ServiceInstance{}, fmt.Errorf("invalid port %d", d.Port)
+	}
+
+	service := consul.ServiceInstance{
+		ID:   d.ID,
+		Name: d.Name,
+		Host: d.Address,
+		Port: d.Port,
+		Tags: d.Tags,
+		Meta: d.Meta,
+	}
+	if service.ID == "" {
+		service.ID = d.Name
+		if d.Address != "" {
+			service.ID = fmt.Sprintf("%s_%d", d.Address, d.Port)
+		}
+	}
+
+	for key, address := range d.TaggedAddresses {
+		if !consul.IsTaggedAddress(key) {
+			return consul.ServiceInstance{}, fmt.Errorf("unknown tagged address %q", key)
+		}
+		if address.Address == "" || address.Port < 0 || address.Port > 65535 {
+			return consul.ServiceInstance{}, fmt.Errorf("invalid %s tagged address", key)
+		}
+		if service.TaggedAddresses == nil {
+			service.TaggedAddresses = map[string]consul.ServiceAddress{}
+		}
+		service.TaggedAddresses[key] = consul.ServiceAddress{Address: address.Address, Port: address.Port}
+	}
+
+	if d.Weights != nil {
+		if d.Weights.Passing < 1 || d.Weights.Warning < 0 {
+			return consul.ServiceInstance{}, errors.New("invalid weights, passing must be positive and warning cannot be negative")
+		}
+		service.Weights = &consul.Weights{Passing: d.Weights.Passing, Warning: d.Weights.Warning}
+	}
+
+	if d.Connect != nil && d.Connect.Native {
+		service.Connect = &consul.Connect{Native: true}
+	}
+
+	if d.Check != nil {
+		check, err := d.Check.toCheck()
+		if err != nil {
+			return consul.ServiceInstance{}, fmt.Errorf("check: %s", err)
+		}
+		service.Check = check
+	}
+	for idx, definition := range d.Checks {
+		check, err := definition.toCheck()
+		if err != nil {
+			return consul.ServiceInstance{}, fmt.Errorf("check %d: %s", idx, err)
+		}
+		service.Checks = append(service.Checks, check)
+	}
+
+	return service, nil
+}
+
+func (d checkDefinition) toCheck() (*consul.Check, error) {
+	check := &consul.Check{
+		Name:                           d.Name,
+		Interval:                       time.Duration(d.Interval),
+		Timeout:                        time.Duration(d.Timeout),
+		DeregisterCriticalServiceAfter: time.Duration(d.DeregisterCriticalServiceAfter),
+	}
+
+	var kinds []string
+	if d.HTTP != "" {
+		kinds = append(kinds, "http")
+		check.Type = consul.CheckHTTP
+		check.Address = d.HTTP
+		check.Method = strings.ToUpper(d.Method)
+		if check.Method == "" {
+			check.Method = http.MethodGet
+		}
+		check.Header = d.Header
+		check.TLSSkipVerify = d.TLSSkipVerify
+	}
+	if d.TCP != "" {
+		kinds = append(kinds, "tcp")
+		check.Type = consul.CheckTCP
+		check.Address = d.TCP
+	}
+	if d.GRPC != "" {
+		kinds = append(kinds, "grpc")
+		check.Type = consul.CheckGRPC
+		check.Address = d.GRPC
+		check.UseTLS = d.GRPCUseTLS
+		check.TLSSkipVerify = d.TLSSkipVerify
+	}
+	if d.H2Ping != "" {
+		kinds = append(kinds, "h2ping")
+		check.Type = consul.CheckH2Ping
+		check.Address = d.H2Ping
+		check.UseTLS = d.H2PingUseTLS
+		check.TLSSkipVerify = d.TLSSkipVerify
+	}
+	if d.TTL != 0 {
+		kinds = append(kinds, "ttl")
+		check.Type = consul.CheckTTL
+		check.TTL = time.Duration(d.TTL)
+	}
+	if len(d.Args) > 0 {
+		kinds = append(kinds, "args")
+		check.Type = consul.CheckScript
+		check.Args = d.Args
+	}
+
+	switch {
+	case len(kinds) == 0:
+		return nil, errors.New("one of http, tcp, grpc, h2ping, ttl or args is required")
+	case len(kinds) > 1:
+		return nil, fmt.Errorf("only one of http, tcp, grpc, h2ping, ttl or args is allowed, got %s", strings.Join(kinds, ", "))
+	case check.Type != consul.CheckTTL && check.Interval <= 0:
+		return nil, errors.New("interval is required")
+	case check.Timeout < 0:
+		return nil, errors.New("timeout cannot be negative")
+	}
+	if check.Type != consul.CheckHTTP && (d.Method != "" || len(d.Header) > 0) {
+		return nil, errors.New("method and header are allowed only for http checks")
+	}
+	if d.TLSSkipVerify && check.Type != consul.CheckHTTP && check.Type != consul.CheckGRPC && check.Type != consul.CheckH2Ping {
+		return nil, errors.New("tls_skip_verify is allowed only for http, grpc and h2ping checks")
+	}
+	if d.GRPCUseTLS && check.Type != consul.CheckGRPC || d.H2PingUseTLS && check.Type != consul.CheckH2Ping {
+		return nil, errors.New("grpc_use_tls and h2ping_use_tls are allowed only for grpc and h2ping checks respectively")
+	}
+
+	return check, nil
+}
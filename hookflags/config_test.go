@@ -0,0 +1,171 @@
+package hookflags
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/allegro/consul-registration-hook/consul"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIfLoadsMultipleServicesFromYAML(t *testing.T) {
+	services, err := LoadServiceDefinitions("testdata/services.yaml")
+
+	require.NoError(t, err)
+	require.Len(t, services, 2)
+
+	web := services[0]
+	assert.Equal(t, "192.0.2.2_8080", web.ID)
+	assert.Equal(t, []string{"http", "frontend"}, web.Tags)
+	assert.Equal(t, &consul.Check{
+		Type:     consul.CheckHTTP,
+		Address:  "http://192.0.2.2:8080/status/ping",
+		Method:   http.MethodHead,
+		Header:   map[string][]string{"X-Check": {"consul"}},
+		Interval: 10 * time.Second,
+		Timeout:  2 * time.Second,
+	}, web.Check)
+	require.Len(t, web.Checks, 2)
+	assert.Equal(t, consul.CheckTCP, web.Checks[0].Type)
+	assert.Equal(t, consul.CheckTTL, web.Checks[1].Type)
+	assert.Equal(t, time.Minute, web.Checks[1].TTL)
+	assert.Equal(t, 5*time.Minute, web.Checks[1].DeregisterCriticalServiceAfter)
+
+	assert.Equal(t, "worker-1", services[1].ID)
+	assert.Nil(t, services[1].Check)
+}
+
+func TestIfLoadsSingleServiceFromJSON(t *testing.T) {
+	services, err := LoadServiceDefinitions("testdata/service.json")
+
+	require.NoError(t, err)
+	require.Len(t, services, 1)
+	assert.Equal(t, "web", services[0].ID)
+	assert.Equal(t, consul.CheckScript, services[0].Check.Type)
+	assert.Equal(t, []string{"/bin/check", "--fast"}, services[0].Check.Args)
+}
+
+func TestIfLoadsMetaWeightsAndGRPCCheck(t *testing.T) {
+	services, err := parseServiceDefinitions([]byte(`
+service:
+  name: api
+  address: 192.0.2.2
+  port: 9090
+  meta:
+    version: "2"
+  weights:
+    passing: 10
+    warning: 1
+  check:
+    grpc: 192.0.2.2:9090/api.Health
+    grpc_use_tls: true
+    tls_skip_verify: true
+    interval: 10s
+  checks:
+    - h2ping: 192.0.2.2:9090
+      interval: 30s
+`))
+
+	require.NoError(t, err)
+	require.Len(t, services, 1)
+	assert.Equal(t, map[string]string{"version": "2"}, services[0].Meta)
+	assert.Equal(t, &consul.Weights{Passing: 10, Warning: 1}, services[0].Weights)
+	assert.Equal(t, &consul.Check{
+		Type:          consul.CheckGRPC,
+		Address:       "192.0.2.2:9090/api.Health",
+		UseTLS:        true,
+		TLSSkipVerify: true,
+		Interval:      10 * time.Second,
+	}, services[0].Check)
+	require.Len(t, services[0].Checks, 1)
+	assert.Equal(t, consul.CheckH2Ping, services[0].Checks[0].Type)
+	assert.False(t, services[0].Checks[0].UseTLS)
+}
+
+func TestIfLoadsNativeConnectService(t *testing.T) {
+	services, err := parseServiceDefinitions([]byte(`{"service": {"name": "api", "connect": {"native": true}}}`))
+
+	require.NoError(t, err)
+	require.Len(t, services, 1)
+	assert.Equal(t, &consul.Connect{Native: true}, services[0].Connect)
+}
+
+func TestIfLoadsTaggedAddresses(t *testing.T) {
+	services, err := parseServiceDefinitions([]byte(`
+service:
+  name: api
+  address: 10.0.0.2
+  port: 8080
+  tagged_addresses:
+    lan:
+      address: 10.0.0.2
+      port: 8080
+    wan:
+      address: 198.51.100.2
+      port: 30080
+`))
+
+	require.NoError(t, err)
+	require.Len(t, services, 1)
+	assert.Equal(t, map[string]consul.ServiceAddress{
+		consul.TaggedAddressLAN: {Address: "10.0.0.2", Port: 8080},
+		consul.TaggedAddressWAN: {Address: "198.51.100.2", Port: 30080},
+	}, services[0].TaggedAddresses)
+}
+
+func TestIfLoadsServiceDefinitionWithCamelCaseKeys(t *testing.T) {
+	services, err := parseServiceDefinitions([]byte(`{
+  "Service": {
+    "ID": "api-1",
+    "Name": "api",
+    "Port": 8443,
+    "Meta": {"build_id": "42"},
+    "TaggedAddresses": {"lan_ipv4": {"Address": "192.0.2.2", "Port": 8443}},
+    "Check": {
+      "HTTP": "https://192.0.2.2:8443/status",
+      "TLSSkipVerify": true,
+      "Interval": "10s",
+      "DeregisterCriticalServiceAfter": "5m"
+    }
+  }
+}`))
+
+	require.NoError(t, err)
+	require.Len(t, services, 1)
+	assert.Equal(t, "api-1", services[0].ID)
+	assert.Equal(t, map[string]string{"build_id": "42"}, services[0].Meta)
+	assert.Equal(t, consul.ServiceAddress{Address: "192.0.2.2", Port: 8443}, services[0].TaggedAddresses[consul.TaggedAddressLANIPv4])
+	assert.True(t, services[0].Check.TLSSkipVerify)
+	assert.Equal(t, 5*time.Minute, services[0].Check.DeregisterCriticalServiceAfter)
+}
+
+func TestIfRejectsInvalidServiceDefinitions(t *testing.T) {
+	testCases := map[string]string{
+		`{}`:                                     "no services defined",
+		`{"service": {"port": 80}}`:              `service 0 (""): missing name`,
+		`{"service": {"name": "a", "prot": 80}}`: `unsupported field "prot"`,
+		`{"service": {"name": "a", "enable_tag_override": true}}`:                                        `unsupported field "enable_tag_override"`,
+		`{"service": {"name": "a", "port": 80, "Port": 81}}`:                                             `duplicated keys`,
+		`{"services": [{"name": "a"}, {"name": "a"}]}`:                                                   `service 1 ("a"): duplicated id "a"`,
+		`{"service": {"name": "a", "check": {"interval": "10s"}}}`:                                       "one of http, tcp, grpc, h2ping, ttl or args is required",
+		`{"service": {"name": "a", "check": {"tcp": "a:1", "ttl": "1m"}}}`:                               "only one of http, tcp, grpc, h2ping, ttl or args is allowed, got tcp, ttl",
+		`{"service": {"name": "a", "checks": [{"tcp": "a:1"}]}}`:                                         `service 0 ("a"): check 0: interval is required`,
+		`{"service": {"name": "a", "check": {"tcp": "a:1", "interval": "10"}}}`:                          "missing unit in duration",
+		`{"service": {"name": "a", "check": {"ttl": "1m", "method": "POST"}}}`:                           "allowed only for http checks",
+		`{"service": {"name": "a", "check": {"tcp": "a:1", "interval": "1s", "tls_skip_verify": true}}}`: "tls_skip_verify is allowed only for http, grpc and h2ping checks",
+		`{"service": {"name": "a", "check": {"tcp": "a:1", "interval": "1s", "grpc_use_tls": true}}}`:    "grpc_use_tls and h2ping_use_tls are allowed only",
+		`{"service": {"name": "a", "weights": {"passing": 0, "warning": 1}}}`:                            "invalid weights",
+		`{"service": {"name": "a", "tagged_addresses": {"public": {"address": "a"}}}}`:                   `unknown tagged address "public"`,
+		`{"service": {"name": "a", "tagged_addresses": {"wan": {"port": 80}}}}`:                          "invalid wan tagged address",
+		"service:\n  name: a\n  port: 70000\n":                                                           "invalid port 70000",
+	}
+
+	for definition, expectedError := range testCases {
+		_, err := parseServiceDefinitions([]byte(definition))
+
+		require.Error(t, err, definition)
+		assert.Contains(t, err.Error(), expectedError, definition)
+	}
+}
@@ -2,8 +2,12 @@ package hookflags
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
+	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,63 +17,198 @@ import (
 
 const (
 	serviceTagsSeparator = ","
+	headerSeparator      = ":"
+
+	// CheckTypeHTTP is a plain HTTP check type.
+	CheckTypeHTTP = "http"
+	// CheckTypeHTTPS is an HTTP check type over TLS.
+	CheckTypeHTTPS = "https"
+	// CheckTypeTCP is a TCP connection check type.
+	CheckTypeTCP = "tcp"
+	// CheckTypeGRPC is a gRPC health checking protocol check type.
+	CheckTypeGRPC = "grpc"
+	// CheckTypeH2Ping is an HTTP/2 PING check type.
+	CheckTypeH2Ping = "h2ping"
+	// CheckTypeTTL is a check type updated by the service itself.
+	CheckTypeTTL = "ttl"
+	// CheckTypeNone disables check registration.
+	CheckTypeNone = "none"
 )
 
 // ServiceProvider is responsible for providing services that should be registered
 // in Consul discovery service.
 type ServiceProvider struct {
-	FlagServiceName   string
-	FlagPodIP         string
-	FlagContainerPort string
-	FlagServiceTags   string
-	FlagCheckPath     string
-	CLIContext        *cli.Context
+	FlagServiceName          string
+	FlagPodIP                string
+	FlagContainerPort        string
+	FlagServiceTags          string
+	FlagCheckPath            string
+	FlagCheckType            string
+	FlagCheckInterval        string
+	FlagCheckTimeout         string
+	FlagCheckMethod          string
+	FlagCheckHeaders         string
+	FlagCheckTLSSkipVerify   string
+	FlagCheckDeregisterAfter string
+	FlagConnectNative        string
+	// FlagConfig names optional flag with service definition file location,
+	// which takes precedence over other flags.
+	FlagConfig string
+	CLIContext *cli.Context
+}
+
+// checkOptions holds check configuration passed by flags.
+type checkOptions struct {
+	checkType       string
+	path            string
+	interval        time.Duration
+	timeout         time.Duration
+	method          string
+	headers         []string
+	tlsSkipVerify   bool
+	deregisterAfter time.Duration
 }
 
 // Get returns slice of services that are configured to be registered in Consul
 // discovery service.
 func (p *ServiceProvider) Get(ctx context.Context) ([]consul.ServiceInstance, error) {
+	if p.FlagConfig != "" {
+		if path := p.CLIContext.String(p.FlagConfig); path != "" {
+			return LoadServiceDefinitions(path)
+		}
+	}
+
 	serviceName := p.CLIContext.String(p.FlagServiceName)
 	host := p.CLIContext.String(p.FlagPodIP)
 	port := p.CLIContext.Int(p.FlagContainerPort)
-	path := p.CLIContext.String(p.FlagCheckPath)
+
+	check, err := getConsulCheck(host, port, checkOptions{
+		checkType:       p.CLIContext.String(p.FlagCheckType),
+		path:            p.CLIContext.String(p.FlagCheckPath),
+		interval:        p.CLIContext.Duration(p.FlagCheckInterval),
+		timeout:         p.CLIContext.Duration(p.FlagCheckTimeout),
+		method:          p.CLIContext.String(p.FlagCheckMethod),
+		headers:         p.CLIContext.StringSlice(p.FlagCheckHeaders),
+		tlsSkipVerify:   p.CLIContext.Bool(p.FlagCheckTLSSkipVerify),
+		deregisterAfter: p.CLIContext.Duration(p.FlagCheckDeregisterAfter),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid check configuration: %s", err)
+	}
 
 	service := consul.ServiceInstance{
 		ID:    fmt.Sprintf("%s_%d", host, port),
 		Name:  serviceName,
 		Host:  host,
 		Port:  port,
-		Check: getConsulHTTPCheck(host, port, path),
+		Check: check,
 	}
 
 	service.Tags = append(service.Tags, p.getTags()...)
+	if p.FlagConnectNative != "" && p.CLIContext.Bool(p.FlagConnectNative) {
+		service.Connect = &consul.Connect{Native: true}
+	}
 
 	return []consul.ServiceInstance{service}, nil
 }
 
 func (p *ServiceProvider) getTags() []string {
-	return strings.Split(p.CLIContext.String(p.FlagServiceTags), serviceTagsSeparator)
+	var tags []string
+	for _, tag := range strings.Split(p.CLIContext.String(p.FlagServiceTags), serviceTagsSeparator) {
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
 }
 
-func getConsulHTTPCheck(host string, port int, path string) *consul.Check {
-	var checkType consul.CheckType
-	var address string
+// getConsulCheck returns check for the service, or nil when no check was
+// requested. When check type is not set, HTTP check is used if check path is
+// set.
+func getConsulCheck(host string, port int, opts checkOptions) (*consul.Check, error) {
+	checkType := strings.ToLower(opts.checkType)
+	if checkType == "" {
+		checkType = CheckTypeNone
+		if opts.path != "" {
+			checkType = CheckTypeHTTP
+		}
+	}
 
-	checkType = consul.CheckHTTPGet
-	u := url.URL{
-		Host:   fmt.Sprintf("%s:%d", host, port),
-		Path:   path,
-		Scheme: "http",
+	isHTTP := checkType == CheckTypeHTTP || checkType == CheckTypeHTTPS
+	if !isHTTP && (opts.method != "" || len(opts.headers) > 0 || opts.tlsSkipVerify) {
+		return nil, fmt.Errorf("method, headers and TLS skip verify are allowed only for http and https checks, got %s", checkType)
+	}
+	if !isHTTP && checkType != CheckTypeGRPC && opts.path != "" {
+		return nil, fmt.Errorf("path is allowed only for http, https and grpc checks, got %s", checkType)
 	}
-	address = u.String()
 
-	interval := 30 * time.Second
-	timeout := 30 * time.Second
+	address := net.JoinHostPort(host, strconv.Itoa(port))
+	check := &consul.Check{
+		Interval:                       opts.interval,
+		Timeout:                        opts.timeout,
+		DeregisterCriticalServiceAfter: opts.deregisterAfter,
+	}
 
-	return &consul.Check{
-		Type:     checkType,
-		Address:  address,
-		Interval: interval,
-		Timeout:  timeout,
+	switch checkType {
+	case CheckTypeNone:
+		return nil, nil
+	case CheckTypeHTTP, CheckTypeHTTPS:
+		header, err := parseHeaders(opts.headers)
+		if err != nil {
+			return nil, err
+		}
+		u := url.URL{
+			Host:   address,
+			Path:   opts.path,
+			Scheme: checkType,
+		}
+		check.Type = consul.CheckHTTP
+		check.Address = u.String()
+		check.Method = strings.ToUpper(opts.method)
+		if check.Method == "" {
+			check.Method = http.MethodGet
+		}
+		check.Header = header
+		check.TLSSkipVerify = opts.tlsSkipVerify
+	case CheckTypeTCP:
+		check.Type = consul.CheckTCP
+		check.Address = address
+	case CheckTypeGRPC:
+		// Path names gRPC service to check, whole server is checked otherwise.
+		check.Type = consul.CheckGRPC
+		check.Address = address
+		if service := strings.TrimPrefix(opts.path, "/"); service != "" {
+			check.Address = address + "/" + service
+		}
+	case CheckTypeH2Ping:
+		check.Type = consul.CheckH2Ping
+		check.Address = address
+	case CheckTypeTTL:
+		check.Type = consul.CheckTTL
+		check.TTL = opts.interval
+	default:
+		return nil, fmt.Errorf("unknown check type %q", opts.checkType)
+	}
+
+	if checkType == CheckTypeTTL && check.TTL <= 0 || checkType != CheckTypeTTL && check.Interval <= 0 {
+		return nil, errors.New("check interval must be positive")
+	}
+
+	return check, nil
+}
+
+func parseHeaders(headers []string) (map[string][]string, error) {
+	if len(headers) == 0 {
+		return nil, nil
+	}
+	header := make(map[string][]string)
+	for _, h := range headers {
+		parts := strings.SplitN(h, headerSeparator, 2)
+		name := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || name == "" {
+			return nil, fmt.Errorf("invalid header %q, expected \"Name: value\" format", h)
+		}
+		header[name] = append(header[name], strings.TrimSpace(parts[1]))
 	}
+	return header, nil
 }
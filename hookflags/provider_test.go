@@ -0,0 +1,100 @@
+package hookflags
+
+import (
+	"testing"
+	"time"
+
+	"github.com/allegro/consul-registration-hook/consul"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIfReturnsNoCheckWhenNotRequested(t *testing.T) {
+	check, err := getConsulCheck("192.0.2.2", 8080, checkOptions{interval: time.Second})
+
+	require.NoError(t, err)
+	assert.Nil(t, check)
+}
+
+func TestIfDefaultsToHTTPCheckWhenPathIsSet(t *testing.T) {
+	check, err := getConsulCheck("192.0.2.2", 8080, checkOptions{
+		path:     "/status/ping",
+		interval: 10 * time.Second,
+		timeout:  time.Second,
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, &consul.Check{
+		Type:     consul.CheckHTTP,
+		Address:  "http://192.0.2.2:8080/status/ping",
+		Method:   "GET",
+		Interval: 10 * time.Second,
+		Timeout:  time.Second,
+	}, check)
+}
+
+func TestIfBuildsConfiguredChecks(t *testing.T) {
+	check, err := getConsulCheck("192.0.2.2", 8443, checkOptions{
+		checkType:       "HTTPS",
+		path:            "/status",
+		method:          "head",
+		headers:         []string{"X-Token: a", "X-Token: b"},
+		tlsSkipVerify:   true,
+		interval:        time.Second,
+		deregisterAfter: time.Minute,
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, "https://192.0.2.2:8443/status", check.Address)
+	assert.Equal(t, "HEAD", check.Method)
+	assert.Equal(t, map[string][]string{"X-Token": {"a", "b"}}, check.Header)
+	assert.True(t, check.TLSSkipVerify)
+	assert.Equal(t, time.Minute, check.DeregisterCriticalServiceAfter)
+
+	check, err = getConsulCheck("192.0.2.2", 8080, checkOptions{checkType: "tcp", interval: time.Second})
+
+	require.NoError(t, err)
+	assert.Equal(t, consul.CheckTCP, check.Type)
+	assert.Equal(t, "192.0.2.2:8080", check.Address)
+
+	check, err = getConsulCheck("192.0.2.2", 8080, checkOptions{checkType: "grpc", path: "/api.Health", interval: time.Second})
+
+	require.NoError(t, err)
+	assert.Equal(t, consul.CheckGRPC, check.Type)
+	assert.Equal(t, "192.0.2.2:8080/api.Health", check.Address)
+
+	check, err = getConsulCheck("192.0.2.2", 8080, checkOptions{checkType: "h2ping", interval: time.Second})
+
+	require.NoError(t, err)
+	assert.Equal(t, consul.CheckH2Ping, check.Type)
+	assert.Equal(t, "192.0.2.2:8080", check.Address)
+
+	check, err = getConsulCheck("192.0.2.2", 8080, checkOptions{checkType: "ttl", interval: time.Minute})
+
+	require.NoError(t, err)
+	assert.Equal(t, consul.CheckTTL, check.Type)
+	assert.Equal(t, time.Minute, check.TTL)
+
+	check, err = getConsulCheck("192.0.2.2", 8080, checkOptions{checkType: "none", interval: time.Second})
+
+	require.NoError(t, err)
+	assert.Nil(t, check)
+}
+
+func TestIfRejectsInvalidCheckConfiguration(t *testing.T) {
+	testCases := []checkOptions{
+		{checkType: "udp", interval: time.Second},
+		{checkType: "tcp", path: "/status", interval: time.Second},
+		{checkType: "h2ping", path: "/status", interval: time.Second},
+		{checkType: "grpc", tlsSkipVerify: true, interval: time.Second},
+		{checkType: "ttl", method: "POST", interval: time.Second},
+		{checkType: "http", headers: []string{"no separator"}, interval: time.Second},
+		{checkType: "http"},
+	}
+
+	for _, testCase := range testCases {
+		_, err := getConsulCheck("192.0.2.2", 8080, testCase)
+
+		assert.Error(t, err, "%+v", testCase)
+	}
+}
@@ -0,0 +1,114 @@
+package k8s
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/allegro/consul-registration-hook/consul"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	connectAnnotation                 = "consulConnect"
+	connectProxyPortAnnotation        = "consulConnectProxyPort"
+	connectLocalServicePortAnnotation = "consulConnectLocalServicePort"
+	connectUpstreamsAnnotation        = "consulConnectUpstreams"
+
+	connectSidecar     = "sidecar"
+	connectNative      = "native"
+	upstreamsSeparator = ","
+)
+
+// getConnect returns Connect configuration from pod annotations, or nil when
+// pod is not registered in Consul service mesh.
+func getConnect(pod *corev1.Pod) (*consul.Connect, error) {
+	mode := pod.Annotations[connectAnnotation]
+	switch mode {
+	case "":
+		return nil, nil
+	case connectNative:
+		return &consul.Connect{Native: true}, nil
+	case connectSidecar:
+	default:
+		return nil, fmt.Errorf("unsupported %s annotation value %q", connectAnnotation, mode)
+	}
+
+	sidecar := &consul.SidecarProxy{}
+	var err error
+	if sidecar.Port, err = getPortAnnotation(pod, connectProxyPortAnnotation); err != nil {
+		return nil, err
+	}
+	if sidecar.LocalServicePort, err = getPortAnnotation(pod, connectLocalServicePortAnnotation); err != nil {
+		return nil, err
+	}
+	if sidecar.Upstreams, err = parseUpstreams(pod.Annotations[connectUpstreamsAnnotation]); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %s", connectUpstreamsAnnotation, err)
+	}
+	return &consul.Connect{Sidecar: sidecar}, nil
+}
+
+// withConnect applies Connect configuration from pod annotations to the first
+// service, keeping native Connect set by port definition label.
+func withConnect(services []consul.ServiceInstance, connect *consul.Connect) ([]consul.ServiceInstance, error) {
+	if connect != nil && len(services) > 0 {
+		if services[0].Connect != nil && services[0].Connect.Native {
+			connect.Native = true
+		}
+		services[0].Connect = connect
+		if connect.Native {
+			services[0].Tags = withoutLBaaSTags(services[0].Tags)
+		}
+	}
+	for _, service := range services {
+		if err := service.Connect.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid Connect configuration of %q service: %s", service.Name, err)
+		}
+	}
+	return services, nil
+}
+
+func getPortAnnotation(pod *corev1.Pod, annotation string) (int, error) {
+	value := pod.Annotations[annotation]
+	if value == "" {
+		return 0, nil
+	}
+	port, err := parsePort(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s annotation: %s", annotation, err)
+	}
+	return port, nil
+}
+
+// parseUpstreams parses comma separated list of upstreams in service:port
+// format, e.g. "db:5432,cache:6379".
+func parseUpstreams(value string) ([]consul.Upstream, error) {
+	var upstreams []consul.Upstream
+	for _, upstream := range strings.Split(value, upstreamsSeparator) {
+		upstream = strings.TrimSpace(upstream)
+		if upstream == "" {
+			continue
+		}
+		separator := strings.LastIndex(upstream, ":")
+		if separator <= 0 {
+			return nil, fmt.Errorf("upstream %q should be in service:port format", upstream)
+		}
+		port, err := parsePort(upstream[separator+1:])
+		if err != nil {
+			return nil, fmt.Errorf("upstream %q: %s", upstream, err)
+		}
+		upstreams = append(upstreams, consul.Upstream{
+			DestinationName: upstream[:separator],
+			LocalBindPort:   port,
+		})
+	}
+	return upstreams, nil
+}
+
+func parsePort(value string) (int, error) {
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid port %q", value)
+	}
+	return port, nil
+}
@@ -0,0 +1,97 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/allegro/consul-registration-hook/consul"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIfRendersSidecarProxyFromAnnotations(t *testing.T) {
+	pod := composeTestCasePod(map[string]string{
+		connectAnnotation:                 "sidecar",
+		connectProxyPortAnnotation:        "21000",
+		connectLocalServicePortAnnotation: "8081",
+		connectUpstreamsAnnotation:        "db:5432, cache:6379",
+	})
+
+	services, err := (&ServiceProvider{}).Render(pod, nil)
+
+	require.NoError(t, err)
+	require.Len(t, services, 1)
+	assert.Equal(t, &consul.Connect{Sidecar: &consul.SidecarProxy{
+		Port:             21000,
+		LocalServicePort: 8081,
+		Upstreams: []consul.Upstream{
+			{DestinationName: "db", LocalBindPort: 5432},
+			{DestinationName: "cache", LocalBindPort: 6379},
+		},
+	}}, services[0].Connect)
+}
+
+func TestIfRendersServiceWithoutConnectByDefault(t *testing.T) {
+	services, err := (&ServiceProvider{}).Render(composeTestCasePod(nil), nil)
+
+	require.NoError(t, err)
+	require.Len(t, services, 1)
+	assert.Nil(t, services[0].Connect)
+}
+
+func TestIfRejectsInvalidConnectAnnotations(t *testing.T) {
+	testCases := map[string]map[string]string{
+		`unsupported consulConnect annotation value "proxy"`: {connectAnnotation: "proxy"},
+		`invalid consulConnectProxyPort annotation: invalid port "0"`: {
+			connectAnnotation:          "sidecar",
+			connectProxyPortAnnotation: "0",
+		},
+		`invalid consulConnectUpstreams annotation: upstream "db" should be in service:port format`: {
+			connectAnnotation:          "sidecar",
+			connectUpstreamsAnnotation: "db",
+		},
+		`invalid consulConnectUpstreams annotation: upstream "db:x": invalid port "x"`: {
+			connectAnnotation:          "sidecar",
+			connectUpstreamsAnnotation: "db:x",
+		},
+	}
+
+	for expectedError, annotations := range testCases {
+		_, err := (&ServiceProvider{}).Render(composeTestCasePod(annotations), nil)
+
+		assert.EqualError(t, err, expectedError)
+	}
+}
+
+func TestIfGeneratesNativeConnectServiceFromPortDefinitionLabel(t *testing.T) {
+	setEnv(t, "testdata/port_definitions_connect_native.json")
+	defer unsetEnv(t)
+	pod := testPod()
+	pod.Status.PodIP = "192.0.2.2"
+
+	services, err := generateServices("serviceName", pod, []string{"a", "lbaas:internal"})
+
+	require.NoError(t, err)
+	require.Len(t, services, 2)
+	assert.Nil(t, services[0].Connect)
+	assert.Contains(t, services[0].Tags, "lbaas:internal")
+	assert.Equal(t, "192.0.2.2_31011", services[1].ID)
+	assert.Equal(t, &consul.Connect{Native: true}, services[1].Connect)
+	assert.NotContains(t, services[1].Tags, "lbaas:internal")
+	assert.Contains(t, services[1].Tags, "a")
+}
+
+func TestIfRendersNativeConnectServiceFromAnnotation(t *testing.T) {
+	services, err := (&ServiceProvider{}).Render(composeTestCasePod(map[string]string{connectAnnotation: "native"}), nil)
+
+	require.NoError(t, err)
+	require.Len(t, services, 1)
+	assert.Equal(t, &consul.Connect{Native: true}, services[0].Connect)
+}
+
+func TestIfRejectsSidecarForNativeConnectService(t *testing.T) {
+	services := []consul.ServiceInstance{{Name: "native", Connect: &consul.Connect{Native: true}}}
+
+	_, err := withConnect(services, &consul.Connect{Sidecar: &consul.SidecarProxy{}})
+
+	assert.EqualError(t, err, `invalid Connect configuration of "native" service: native Connect service cannot have sidecar proxy`)
+}
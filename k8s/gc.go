@@ -0,0 +1,72 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/allegro/consul-registration-hook/consul"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// FindOrphans returns services registered for pods that no longer run on the
+// given node. Services without pod name and namespace tags are ignored. Pod
+// that was recreated on the node with a different IP, evicted or completed is
+// considered gone. It
+// fails when the node does not exist or no pods run on it while services of
+// pods are registered, as it is more likely a misconfiguration than a node
+// without pods.
+func (p *ServiceProvider) FindOrphans(ctx context.Context, nodeName string, services []consul.ServiceInstance) ([]consul.ServiceInstance, error) {
+	client, err := p.client()
+	if err != nil {
+		return nil, fmt.Errorf("unable create K8S API client: %s", err)
+	}
+
+	if _, err := client.GetNode(ctx, nodeName); err != nil {
+		return nil, fmt.Errorf("unable to find node %q: %s", nodeName, err)
+	}
+
+	pods, err := client.ListNodePods(ctx, nodeName)
+	if err != nil {
+		return nil, err
+	}
+
+	podIPs := make(map[string]string, len(pods))
+	for _, pod := range pods {
+		// Evicted and completed pods stay listed on the node until deleted.
+		if pod.Status.Phase == corev1.PodFailed || pod.Status.Phase == corev1.PodSucceeded {
+			continue
+		}
+		podIPs[pod.Namespace+"/"+pod.Name] = pod.Status.PodIP
+	}
+
+	var orphans []consul.ServiceInstance
+	for _, service := range services {
+		namespace, name, ok := podFromTags(service.Tags)
+		if !ok {
+			continue
+		}
+		if len(pods) == 0 {
+			return nil, fmt.Errorf("no pods listed on node %q while services of pods are registered, refusing to reap them", nodeName)
+		}
+		podIP, running := podIPs[namespace+"/"+name]
+		if !running || podIP != "" && service.Host != "" && podIP != service.Host {
+			orphans = append(orphans, service)
+		}
+	}
+	return orphans, nil
+}
+
+// podFromTags returns namespace and name of the pod service was registered for.
+func podFromTags(tags []string) (namespace, name string, ok bool) {
+	namePrefix := strings.TrimSuffix(consulPodNameLabelTemplate, "%s")
+	namespacePrefix := strings.TrimSuffix(consulPodNamespaceLabelTemplate, "%s")
+	for _, tag := range tags {
+		if strings.HasPrefix(tag, namePrefix) {
+			name = strings.TrimPrefix(tag, namePrefix)
+		} else if strings.HasPrefix(tag, namespacePrefix) {
+			namespace = strings.TrimPrefix(tag, namespacePrefix)
+		}
+	}
+	return namespace, name, namespace != "" && name != ""
+}
@@ -0,0 +1,100 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/allegro/consul-registration-hook/consul"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestIfFindsServicesOfPodsNoLongerOnNode(t *testing.T) {
+	pods := []corev1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "running"}, Status: corev1.PodStatus{PodIP: "192.0.2.2"}},
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "recreated"}, Status: corev1.PodStatus{PodIP: "192.0.2.4"}},
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "evicted"}, Status: corev1.PodStatus{PodIP: "192.0.2.7", Phase: corev1.PodFailed, Reason: "Evicted"}},
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "completed"}, Status: corev1.PodStatus{PodIP: "192.0.2.8", Phase: corev1.PodSucceeded}},
+	}
+	services := []consul.ServiceInstance{
+		{ID: "running", Host: "192.0.2.2", Tags: []string{"k8sPodName: running", "k8sPodNamespace: default"}},
+		{ID: "recreated", Host: "192.0.2.3", Tags: []string{"k8sPodName: recreated", "k8sPodNamespace: default"}},
+		{ID: "gone", Host: "192.0.2.5", Tags: []string{"k8sPodName: gone", "k8sPodNamespace: default"}},
+		{ID: "other-namespace", Host: "192.0.2.2", Tags: []string{"k8sPodName: running", "k8sPodNamespace: other"}},
+		{ID: "not-k8s", Host: "192.0.2.6", Tags: []string{"tag"}},
+		{ID: "evicted", Host: "192.0.2.7", Tags: []string{"k8sPodName: evicted", "k8sPodNamespace: default"}},
+		{ID: "completed", Host: "192.0.2.8", Tags: []string{"k8sPodName: completed", "k8sPodNamespace: default"}},
+	}
+
+	client := &MockClient{}
+	client.client.On("GetNode", context.Background(), "node").Return(&corev1.Node{}, nil).Once()
+	client.client.On("ListNodePods", context.Background(), "node").Return(pods, nil).Once()
+	provider := ServiceProvider{Client: client}
+
+	orphans, err := provider.FindOrphans(context.Background(), "node", services)
+
+	require.NoError(t, err)
+	var ids []string
+	for _, orphan := range orphans {
+		ids = append(ids, orphan.ID)
+	}
+	assert.Equal(t, []string{"recreated", "gone", "other-namespace", "evicted", "completed"}, ids)
+	client.client.AssertExpectations(t)
+}
+
+func TestIfFailsToFindOrphansOnUnknownNode(t *testing.T) {
+	services := []consul.ServiceInstance{
+		{ID: "service", Host: "192.0.2.2", Tags: []string{"k8sPodName: pod", "k8sPodNamespace: default"}},
+	}
+
+	client := &MockClient{}
+	client.client.On("GetNode", context.Background(), "mistyped").Return(nil, errors.New("not found")).Once()
+	provider := ServiceProvider{Client: client}
+
+	orphans, err := provider.FindOrphans(context.Background(), "mistyped", services)
+
+	require.Error(t, err)
+	assert.Empty(t, orphans)
+	client.client.AssertNotCalled(t, "ListNodePods", mock.Anything, mock.Anything)
+	client.client.AssertExpectations(t)
+}
+
+func TestIfRefusesToFindOrphansWhenNoPodsAreListed(t *testing.T) {
+	services := []consul.ServiceInstance{
+		{ID: "not-k8s", Host: "192.0.2.6", Tags: []string{"tag"}},
+		{ID: "service", Host: "192.0.2.2", Tags: []string{"k8sPodName: pod", "k8sPodNamespace: default"}},
+	}
+
+	client := &MockClient{}
+	client.client.On("GetNode", context.Background(), "node").Return(&corev1.Node{}, nil)
+	client.client.On("ListNodePods", context.Background(), "node").Return([]corev1.Pod{}, nil)
+	provider := ServiceProvider{Client: client}
+
+	orphans, err := provider.FindOrphans(context.Background(), "node", services)
+
+	require.Error(t, err)
+	assert.Empty(t, orphans)
+
+	orphans, err = provider.FindOrphans(context.Background(), "node", services[:1])
+
+	require.NoError(t, err)
+	assert.Empty(t, orphans)
+}
+
+func TestIfListsOnlyPodsScheduledOnNode(t *testing.T) {
+	client := defaultClient{k8sClient: testclient.NewSimpleClientset(
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "a", Name: "on-node"}, Spec: corev1.PodSpec{NodeName: "node"}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "b", Name: "elsewhere"}, Spec: corev1.PodSpec{NodeName: "other"}},
+	)}
+
+	pods, err := client.ListNodePods(context.Background(), "node")
+
+	require.NoError(t, err)
+	require.Len(t, pods, 1)
+	assert.Equal(t, "on-node", pods[0].Name)
+}
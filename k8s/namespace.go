@@ -0,0 +1,53 @@
+package k8s
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// NamespaceMapping maps Kubernetes namespaces to Consul Enterprise namespaces.
+// Explicitly mapped namespaces take precedence over mirroring, namespaces
+// that are neither mapped nor mirrored use the default one.
+type NamespaceMapping struct {
+	// Default is Consul namespace used for unmapped namespaces.
+	Default string
+	// Mirroring registers services in Consul namespace named after Kubernetes
+	// namespace, prefixed with MirroringPrefix.
+	Mirroring       bool
+	MirroringPrefix string
+	// Namespaces maps Kubernetes namespace names to Consul namespace names.
+	Namespaces map[string]string
+}
+
+// ConsulNamespace returns Consul namespace for the Kubernetes namespace.
+func (m NamespaceMapping) ConsulNamespace(namespace string) string {
+	if consulNamespace, ok := m.Namespaces[namespace]; ok {
+		return consulNamespace
+	}
+	if m.Mirroring && namespace != "" {
+		return m.MirroringPrefix + namespace
+	}
+	return m.Default
+}
+
+// LoadNamespaceMap reads YAML or JSON file with Kubernetes namespace names
+// mapped to Consul namespace names.
+func LoadNamespaceMap(path string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read namespace map file: %s", err)
+	}
+	jsonData, err := yaml.ToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse namespace map file: %s", err)
+	}
+
+	namespaces := map[string]string{}
+	if err := json.Unmarshal(jsonData, &namespaces); err != nil {
+		return nil, fmt.Errorf("unable to parse namespace map file: %s", err)
+	}
+	return namespaces, nil
+}
@@ -0,0 +1,40 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIfMapsKubernetesNamespaceToConsulNamespace(t *testing.T) {
+	namespaces, err := LoadNamespaceMap("testdata/namespaces.yaml")
+	require.NoError(t, err)
+
+	tests := []struct {
+		mapping   NamespaceMapping
+		namespace string
+		expected  string
+	}{
+		{NamespaceMapping{}, "team", ""},
+		{NamespaceMapping{Default: "apps"}, "team", "apps"},
+		{NamespaceMapping{Default: "apps", Mirroring: true}, "team", "team"},
+		{NamespaceMapping{Default: "apps", Mirroring: true}, "", "apps"},
+		{NamespaceMapping{Mirroring: true, MirroringPrefix: "k8s-"}, "team", "k8s-team"},
+		{NamespaceMapping{Mirroring: true, Namespaces: namespaces}, "default", "web"},
+		{NamespaceMapping{Default: "apps", Namespaces: namespaces}, "kube-system", "infra"},
+		{NamespaceMapping{Default: "apps", Namespaces: namespaces}, "team", "apps"},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, test.mapping.ConsulNamespace(test.namespace), "%+v %s", test.mapping, test.namespace)
+	}
+}
+
+func TestIfFailsToLoadInvalidNamespaceMap(t *testing.T) {
+	_, err := LoadNamespaceMap("testdata/missing.yaml")
+	assert.Error(t, err)
+
+	_, err = LoadNamespaceMap("testdata/port_definitions.json")
+	assert.Error(t, err)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"sort"
 	"strings"
 )
 
@@ -13,6 +14,8 @@ const (
 	probeLabel         = "probe"
 	serviceLabel       = "service"
 	consulLabel        = "consul"
+	connectLabel       = "connect"
+	wanPortLabel       = "wanPort"
 )
 
 type portDefinitions []portDefinition
@@ -40,6 +43,7 @@ func (pd portDefinition) getTags() []string {
 			tags = append(tags, key)
 		}
 	}
+	sort.Strings(tags)
 	return tags
 }
 
@@ -58,6 +62,30 @@ func (pd portDefinition) labelForConsul() string {
 	return ""
 }
 
+// isConnectNative returns true for ports of apps accepting Connect mTLS
+// connections themselves.
+func (pd portDefinition) isConnectNative() bool {
+	return pd.Labels[connectLabel] == connectNative
+}
+
+// wanPort returns WAN port of the service on given port set with its port
+// definition label, or zero when it is not set.
+func (pds *portDefinitions) wanPort(port int) (int, error) {
+	if pds == nil {
+		return 0, nil
+	}
+	for _, pd := range *pds {
+		if value := pd.Labels[wanPortLabel]; pd.Port == port && value != "" {
+			wanPort, err := parsePort(value)
+			if err != nil {
+				return 0, fmt.Errorf("invalid %s label of port %d: %s", wanPortLabel, port, err)
+			}
+			return wanPort, nil
+		}
+	}
+	return 0, nil
+}
+
 func (pd portDefinition) hasConsulLabel() bool {
 	if _, ok := pd.Labels[consulLabel]; ok {
 		return true
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"sort"
 	"strings"
 	"time"
 
@@ -12,6 +13,7 @@ import (
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 )
@@ -39,6 +41,10 @@ type Client interface {
 	GetFailureDomainTags(ctx context.Context, pod *corev1.Pod) ([]string, error)
 	// DoProbeCheck check if service is alive
 	DoProbeCheck(pod *corev1.Probe, ip string) error
+	// ListNodePods returns pods scheduled on the given node.
+	ListNodePods(ctx context.Context, nodeName string) ([]corev1.Pod, error)
+	// GetNode returns node data.
+	GetNode(ctx context.Context, nodeName string) (*corev1.Node, error)
 }
 
 type defaultClient struct {
@@ -54,6 +60,22 @@ func (c *defaultClient) GetPod(ctx context.Context, namespace string, name strin
 	return pod, nil
 }
 
+func (c *defaultClient) ListNodePods(ctx context.Context, nodeName string) ([]corev1.Pod, error) {
+	pods, err := c.k8sClient.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", nodeName).String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list pods on node (%s) from API: %s", nodeName, err)
+	}
+	var nodePods []corev1.Pod
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName == nodeName {
+			nodePods = append(nodePods, pod)
+		}
+	}
+	return nodePods, nil
+}
+
 func (c *defaultClient) GetNode(ctx context.Context, nodeName string) (*corev1.Node, error) {
 	node, err := c.k8sClient.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
 	if err != nil {
@@ -67,6 +89,10 @@ func (c *defaultClient) GetFailureDomainTags(ctx context.Context, pod *corev1.Po
 	if err != nil {
 		return nil, fmt.Errorf("unable to get node data from API: %s", err)
 	}
+	return getFailureDomainTags(node)
+}
+
+func getFailureDomainTags(node *corev1.Node) ([]string, error) {
 	var tags []string
 	for k, v := range node.Labels {
 		if strings.Contains(k, "failure-domain.beta.kubernetes.io") {
@@ -77,6 +103,7 @@ func (c *defaultClient) GetFailureDomainTags(ctx context.Context, pod *corev1.Po
 	if len(tags) < 1 {
 		return nil, fmt.Errorf("failure domain labels don't exist")
 	}
+	sort.Strings(tags)
 	return tags, nil
 }
 
@@ -86,6 +113,9 @@ type ServiceProvider struct {
 	Client             Client
 	Timeout            time.Duration
 	HealthCheckTimeout time.Duration
+	// WANAddress configures WAN tagged address of services, none is
+	// registered when empty.
+	WANAddress WANAddress
 }
 
 // GenerateSecured generates list of postfixed Consul services for deregistration
@@ -161,23 +191,68 @@ func (p *ServiceProvider) Get(ctx context.Context) ([]consul.ServiceInstance, er
 	if err != nil {
 		log.Printf("Won't include failure domain data in registration: %s", err)
 	}
+
+	services, err := generateServices(serviceName, pod, getGlobalTags(pod, podName, podNamespace, failureDomainTags))
+	if err != nil {
+		return nil, err
+	}
+	return p.WANAddress.withWANAddress(services, pod, p.getWANNode(ctx, client, pod))
+}
+
+// Render returns slice of services that would be registered for passed pod and
+// optional node manifests, without contacting Kubernetes API.
+func (p *ServiceProvider) Render(pod *corev1.Pod, node *corev1.Node) ([]consul.ServiceInstance, error) {
+	serviceName := pod.GetObjectMeta().GetLabels()[consulLabelKey]
+	if serviceName == "" {
+		return nil, nil
+	}
+
+	var failureDomainTags []string
+	if node != nil {
+		var err error
+		if failureDomainTags, err = getFailureDomainTags(node); err != nil {
+			log.Printf("Won't include failure domain data in registration: %s", err)
+		}
+	}
+
+	podName := pod.Name
+	if name := os.Getenv(podNameEnvVar); name != "" {
+		podName = name
+	}
+	podNamespace := pod.Namespace
+	if namespace := os.Getenv(podNamespaceEnvVar); namespace != "" {
+		podNamespace = namespace
+	}
+
+	services, err := generateServices(serviceName, pod, getGlobalTags(pod, podName, podNamespace, failureDomainTags))
+	if err != nil {
+		return nil, err
+	}
+	return p.WANAddress.withWANAddress(services, pod, node)
+}
+
+func getGlobalTags(pod *corev1.Pod, podName, podNamespace string, failureDomainTags []string) []string {
 	var globalTags []string
 
 	if podName != "" && podNamespace != "" {
-		globalTags = append(globalTags, fmt.Sprintf(consulPodNameLabelTemplate, podName))
+		globalTags = append(globalTags, PodNameTag(podName))
 		globalTags = append(globalTags, fmt.Sprintf(consulPodNamespaceLabelTemplate, podNamespace))
 	}
 	globalTags = append(globalTags, failureDomainTags...)
 
 	// annotations allows us to store non alphanumeric values, unlike labels values (alphanumeric, max 63 characters.
-	//annotations := pod.GetMetadata().GetAnnotations()
-	for key, value := range pod.Annotations {
-		if strings.HasPrefix(key, consulTagPrefix) && len(value) > 0 {
+	keys := make([]string, 0, len(pod.Annotations))
+	for key := range pod.Annotations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if value := pod.Annotations[key]; strings.HasPrefix(key, consulTagPrefix) && len(value) > 0 {
 			globalTags = append(globalTags, value)
 		}
 	}
 
-	return generateServices(serviceName, pod, globalTags)
+	return globalTags
 }
 
 // client returns kubernetes clientset
@@ -353,10 +428,23 @@ func generateServices(serviceName string, pod *corev1.Pod, globalTags []string)
 		return nil, err
 	}
 
+	connect, err := getConnect(pod)
+	if err != nil {
+		return nil, err
+	}
+
+	var services []consul.ServiceInstance
 	if portDefinitions == nil {
-		return generateFromContainerPorts(serviceName, pod, globalTags)
+		services, err = generateFromContainerPorts(serviceName, pod, globalTags)
+	} else {
+		services, err = generateFromPortDefinitions(serviceName, portDefinitions, pod, globalTags)
 	}
-	return generateFromPortDefinitions(serviceName, portDefinitions, pod, globalTags)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pod has a single sidecar proxy, it is registered for the first service.
+	return withConnect(services, connect)
 }
 
 func generateFromContainerPorts(serviceName string, pod *corev1.Pod, globalTags []string) ([]consul.ServiceInstance, error) {
@@ -443,13 +531,15 @@ func generateFromPortDefinitions(serviceName string, portDefinitions *portDefini
 				Port:  portDefinition.Port,
 				Check: ConvertToConsulCheck(probe, host),
 			}
+			// Native Connect services are secured like the ones following
+			// -secured naming convention, but keep their IDs unchanged.
+			if portDefinition.isConnectNative() {
+				service.Connect = &consul.Connect{Native: true}
+				isSecureService = true
+			}
 			service.Tags = make([]string, 0, len(portDefinition.getTags())+len(globalTags)+2)
 			if isSecureService {
-				for _, globalTag := range globalTags {
-					if !strings.HasPrefix(globalTag, lbaasPrefix) {
-						service.Tags = append(service.Tags, globalTag)
-					}
-				}
+				service.Tags = append(service.Tags, withoutLBaaSTags(globalTags)...)
 			} else {
 				service.Tags = append(service.Tags, globalTags...)
 			}
@@ -470,6 +560,18 @@ func generateFromPortDefinitions(serviceName string, portDefinitions *portDefini
 	return services, nil
 }
 
+// withoutLBaaSTags filters out load balancer tags, as secured services accept
+// only mTLS connections load balancers cannot open.
+func withoutLBaaSTags(tags []string) []string {
+	var filtered []string
+	for _, tag := range tags {
+		if !strings.HasPrefix(tag, lbaasPrefix) {
+			filtered = append(filtered, tag)
+		}
+	}
+	return filtered
+}
+
 func stringInSlice(a string, list []string) bool {
 	for _, b := range list {
 		if strings.Contains(b, a) {
@@ -479,6 +581,11 @@ func stringInSlice(a string, list []string) bool {
 	return false
 }
 
+// PodNameTag returns tag identifying services registered for the given pod.
+func PodNameTag(podName string) string {
+	return fmt.Sprintf(consulPodNameLabelTemplate, podName)
+}
+
 func createInstanceTag(podName string, podPort int) string {
 	return fmt.Sprintf(instanceFormat, podName, podPort)
 }
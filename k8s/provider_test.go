@@ -506,6 +506,29 @@ func TestIfConvertNodeFailureDomainTagsToConsulTags(t *testing.T) {
 	assert.Contains(t, tags, "zone:zone1")
 }
 
+func TestIfRendersServicesFromManifestsWithoutAPI(t *testing.T) {
+	pod := composeTestCasePod(map[string]string{
+		"CONSUL_TAG_2": "tag-b",
+		"CONSUL_TAG_1": "tag-a",
+	})
+	pod.Namespace = "default"
+
+	services, err := (&ServiceProvider{}).Render(pod, testNode())
+
+	require.NoError(t, err)
+	require.Len(t, services, 1)
+	assert.Equal(t, "192.0.2.2_8080", services[0].ID)
+	assert.Equal(t, []string{
+		"k8sPodName: podName",
+		"k8sPodNamespace: default",
+		"region:region1",
+		"zone:zone1",
+		"tag-a",
+		"tag-b",
+		"instance:podName_8080",
+	}, services[0].Tags)
+}
+
 func testPod() *corev1.Pod {
 	podIP := "192.0.2.2"
 	podName := "podName"
@@ -620,6 +643,22 @@ func (c *MockClient) GetFailureDomainTags(ctx context.Context, pod *corev1.Pod)
 	return args.Get(0).([]string), args.Error(1)
 }
 
+func (c *MockClient) ListNodePods(ctx context.Context, nodeName string) ([]corev1.Pod, error) {
+	args := c.client.Called(ctx, nodeName)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]corev1.Pod), args.Error(1)
+}
+
+func (c *MockClient) GetNode(ctx context.Context, nodeName string) (*corev1.Node, error) {
+	args := c.client.Called(ctx, nodeName)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*corev1.Node), args.Error(1)
+}
+
 func (c *MockClient) DoProbeCheck(pr *corev1.Probe, ip string) error {
 	args := c.client.Called(pr, ip)
 	if args.Get(0) == nil {
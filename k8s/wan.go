@@ -0,0 +1,105 @@
+package k8s
+
+import (
+	"context"
+	"log"
+
+	"github.com/allegro/consul-registration-hook/consul"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const wanPortAnnotation = "consulWANPort"
+
+// WANAddress configures where WAN address of registered services is taken
+// from, so services exposed with NodePort or LoadBalancer can be reached from
+// other datacenters.
+type WANAddress struct {
+	// NodeAnnotation names node annotation holding WAN address, it takes
+	// precedence over node external IP.
+	NodeAnnotation string
+	// NodeExternalIP uses external IP of the node as WAN address.
+	NodeExternalIP bool
+}
+
+// IsEmpty returns true when WAN address is not configured.
+func (w WANAddress) IsEmpty() bool {
+	return w.NodeAnnotation == "" && !w.NodeExternalIP
+}
+
+// fromNode returns WAN address of the node, or empty string when node has
+// none.
+func (w WANAddress) fromNode(node *corev1.Node) string {
+	if w.NodeAnnotation != "" {
+		if address := node.Annotations[w.NodeAnnotation]; address != "" {
+			return address
+		}
+	}
+	if w.NodeExternalIP {
+		for _, address := range node.Status.Addresses {
+			if address.Type == corev1.NodeExternalIP && address.Address != "" {
+				return address.Address
+			}
+		}
+	}
+	return ""
+}
+
+// withWANAddress adds WAN tagged address of the node to services with known
+// WAN port: set by pod annotation for the first service (e.g. its NodePort),
+// by wanPort label of port definition, or the service port of pods using host
+// network. Other services are not reachable on the node address.
+func (w WANAddress) withWANAddress(services []consul.ServiceInstance, pod *corev1.Pod, node *corev1.Node) ([]consul.ServiceInstance, error) {
+	if w.IsEmpty() || node == nil || len(services) == 0 {
+		return services, nil
+	}
+
+	address := w.fromNode(node)
+	if address == "" {
+		log.Printf("Won't include WAN address in registration: node %s has no WAN address", node.Name)
+		return services, nil
+	}
+
+	annotatedPort, err := getPortAnnotation(pod, wanPortAnnotation)
+	if err != nil {
+		return nil, err
+	}
+	portDefinitions, err := getPortDefinitions()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range services {
+		port, err := portDefinitions.wanPort(services[i].Port)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 && annotatedPort != 0 {
+			port = annotatedPort
+		}
+		if port == 0 && pod.Spec.HostNetwork {
+			port = services[i].Port
+		}
+		if port == 0 {
+			log.Printf("Won't include WAN address of %s service: unknown WAN port", services[i].ID)
+			continue
+		}
+		if services[i].TaggedAddresses == nil {
+			services[i].TaggedAddresses = map[string]consul.ServiceAddress{}
+		}
+		services[i].TaggedAddresses[consul.TaggedAddressWAN] = consul.ServiceAddress{Address: address, Port: port}
+	}
+	return services, nil
+}
+
+// getWANNode returns node of the pod when WAN address is configured.
+func (p *ServiceProvider) getWANNode(ctx context.Context, client Client, pod *corev1.Pod) *corev1.Node {
+	if p.WANAddress.IsEmpty() {
+		return nil
+	}
+	node, err := client.GetNode(ctx, pod.Spec.NodeName)
+	if err != nil {
+		log.Printf("Won't include WAN address in registration: %s", err)
+		return nil
+	}
+	return node
+}
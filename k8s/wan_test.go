@@ -0,0 +1,98 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/allegro/consul-registration-hook/consul"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestIfRendersWANAddressFromNodeAnnotation(t *testing.T) {
+	pod := composeTestCasePod(map[string]string{wanPortAnnotation: "30080"})
+	node := testNode()
+	node.Annotations = map[string]string{"example.com/wan-address": "198.51.100.2"}
+	node.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeExternalIP, Address: "198.51.100.3"}}
+	provider := ServiceProvider{WANAddress: WANAddress{NodeAnnotation: "example.com/wan-address", NodeExternalIP: true}}
+
+	services, err := provider.Render(pod, node)
+
+	require.NoError(t, err)
+	require.Len(t, services, 1)
+	assert.Equal(t, map[string]consul.ServiceAddress{
+		consul.TaggedAddressWAN: {Address: "198.51.100.2", Port: 30080},
+	}, services[0].TaggedAddresses)
+}
+
+func TestIfRendersWANAddressFromNodeExternalIP(t *testing.T) {
+	node := testNode()
+	node.Status.Addresses = []corev1.NodeAddress{
+		{Type: corev1.NodeInternalIP, Address: "10.0.0.1"},
+		{Type: corev1.NodeExternalIP, Address: "198.51.100.3"},
+	}
+	pod := composeTestCasePod(nil)
+	pod.Spec.HostNetwork = true
+	provider := ServiceProvider{WANAddress: WANAddress{NodeAnnotation: "example.com/wan-address", NodeExternalIP: true}}
+
+	services, err := provider.Render(pod, node)
+
+	require.NoError(t, err)
+	require.Len(t, services, 1)
+	assert.Equal(t, consul.ServiceAddress{Address: "198.51.100.3", Port: 8080}, services[0].TaggedAddresses[consul.TaggedAddressWAN])
+}
+
+func TestIfRendersWANAddressOnlyOfServicesWithKnownWANPort(t *testing.T) {
+	setEnv(t, "testdata/port_definitions_wan.json")
+	defer unsetEnv(t)
+	pod := composeTestCasePod(map[string]string{wanPortAnnotation: "30080"})
+	node := testNode()
+	node.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeExternalIP, Address: "198.51.100.3"}}
+	provider := ServiceProvider{WANAddress: WANAddress{NodeExternalIP: true}}
+
+	services, err := provider.Render(pod, node)
+
+	require.NoError(t, err)
+	require.Len(t, services, 3)
+	assert.Equal(t, map[string]consul.ServiceAddress{
+		consul.TaggedAddressWAN: {Address: "198.51.100.3", Port: 30080},
+	}, services[0].TaggedAddresses)
+	assert.Equal(t, map[string]consul.ServiceAddress{
+		consul.TaggedAddressWAN: {Address: "198.51.100.3", Port: 30081},
+	}, services[1].TaggedAddresses)
+	assert.Nil(t, services[2].TaggedAddresses)
+}
+
+func TestIfRendersNoWANAddressWhenNodeHasNone(t *testing.T) {
+	provider := ServiceProvider{WANAddress: WANAddress{NodeExternalIP: true}}
+
+	services, err := provider.Render(composeTestCasePod(nil), testNode())
+
+	require.NoError(t, err)
+	require.Len(t, services, 1)
+	assert.Nil(t, services[0].TaggedAddresses)
+}
+
+func TestIfGetsWANAddressOfPodNode(t *testing.T) {
+	pod := composeTestCasePod(nil)
+	pod.Spec.NodeName = "testNode"
+	pod.Spec.HostNetwork = true
+	node := testNode()
+	node.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeExternalIP, Address: "198.51.100.3"}}
+	client := getMockedClient(pod)
+	client.client.On("GetNode", context.Background(), "testNode").Return(node, nil).Once()
+	provider := ServiceProvider{
+		Client:     client,
+		Timeout:    time.Second,
+		WANAddress: WANAddress{NodeExternalIP: true},
+	}
+
+	services, err := provider.Get(context.Background())
+
+	require.NoError(t, err)
+	client.client.AssertExpectations(t)
+	require.Len(t, services, 1)
+	assert.Equal(t, consul.ServiceAddress{Address: "198.51.100.3", Port: 8080}, services[0].TaggedAddresses[consul.TaggedAddressWAN])
+}
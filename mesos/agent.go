@@ -1,17 +1,135 @@
 package mesos
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"strings"
+	"time"
 )
 
 const (
-	defaultAgentBaseURL = "http://localhost:5050"
+	defaultAgentHost    = "localhost"
+	defaultAgentPort    = "5050"
+	defaultAgentTimeout = 10 * time.Second
 	stateEndpointFormat = "%s/state"
+
+	agentEndpointEnvVar = "MESOS_AGENT_ENDPOINT"
+	libprocessIPEnvVar  = "LIBPROCESS_IP"
 )
 
+// AgentAPI is an API used to read tasks from Mesos agent.
+type AgentAPI string
+
+const (
+	// AgentAPIV1 represents v1 operator API GET_TASKS call, falling back to
+	// AgentAPIState when agent does not support it.
+	AgentAPIV1 = AgentAPI("v1")
+	// AgentAPIState represents legacy /state endpoint.
+	AgentAPIState = AgentAPI("state")
+)
+
+// AgentConfig configures connection to Mesos agent API. Zero value connects to
+// the agent found in executor environment without authentication.
+type AgentConfig struct {
+	// URL of Mesos agent. When empty, MESOS_AGENT_ENDPOINT or LIBPROCESS_IP
+	// environmental variables are used, falling back to localhost. HTTPS is
+	// used for them when CAFile is set.
+	URL string
+	// CAFile is a PEM encoded certificate authority used to verify HTTPS agent.
+	CAFile string
+	// Principal and Secret are used for HTTP basic authentication.
+	Principal string
+	Secret    string
+	// TokenFile contains JWT sent as bearer token, used instead of basic
+	// authentication.
+	TokenFile string
+	// Timeout of a single request, defaults to 10 seconds.
+	Timeout time.Duration
+	// API used to read tasks, defaults to AgentAPIV1.
+	API AgentAPI
+}
+
+// baseURL returns agent URL, preferring HTTPS for endpoints taken from
+// environment or the default one when certificate authority is configured.
+func (c AgentConfig) baseURL() string {
+	if c.URL != "" {
+		return strings.TrimSuffix(c.URL, "/")
+	}
+	scheme := "http"
+	if c.CAFile != "" {
+		scheme = "https"
+	}
+	if endpoint := os.Getenv(agentEndpointEnvVar); endpoint != "" {
+		return scheme + "://" + endpoint
+	}
+	if ip := os.Getenv(libprocessIPEnvVar); ip != "" {
+		return scheme + "://" + ip + ":" + defaultAgentPort
+	}
+	return scheme + "://" + defaultAgentHost + ":" + defaultAgentPort
+}
+
+func (c AgentConfig) newClient() (agentClient, error) {
+	client, err := c.newDefaultClient()
+	if err != nil {
+		return nil, err
+	}
+
+	switch c.API {
+	case AgentAPIV1, "":
+		return operatorAgentClient{client}, nil
+	case AgentAPIState:
+		return client, nil
+	default:
+		return nil, fmt.Errorf("unsupported mesos agent API %q", c.API)
+	}
+}
+
+func (c AgentConfig) newDefaultClient() (defaultAgentClient, error) {
+	client := defaultAgentClient{
+		baseURL:    c.baseURL(),
+		httpClient: &http.Client{Timeout: c.Timeout},
+		principal:  c.Principal,
+		secret:     c.Secret,
+	}
+	if client.httpClient.Timeout <= 0 {
+		client.httpClient.Timeout = defaultAgentTimeout
+	}
+
+	if c.CAFile != "" {
+		pem, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return client, fmt.Errorf("unable to read mesos agent CA file: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return client, fmt.Errorf("no certificates found in mesos agent CA file %q", c.CAFile)
+		}
+		client.httpClient.Transport = &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+		}
+	}
+
+	if c.TokenFile != "" {
+		token, err := ioutil.ReadFile(c.TokenFile)
+		if err != nil {
+			return client, fmt.Errorf("unable to read mesos agent token file: %s", err)
+		}
+		client.token = strings.TrimSpace(string(token))
+		if client.token == "" {
+			return client, errors.New("mesos agent token file is empty")
+		}
+	}
+
+	return client, nil
+}
+
 type label struct {
 	Key   string
 	Value string
@@ -37,9 +155,13 @@ type discovery struct {
 }
 
 type task struct {
-	ID        string
-	Labels    []label
-	Discovery discovery
+	ID          string
+	State       string
+	Labels      []label
+	Discovery   discovery
+	HealthCheck *healthCheck `json:"health_check"`
+	Statuses    []taskStatus
+	Container   container
 }
 
 type executor struct {
@@ -61,23 +183,78 @@ type agentClient interface {
 }
 
 type defaultAgentClient struct {
-	baseURL string
+	baseURL    string
+	httpClient *http.Client
+	principal  string
+	secret     string
+	token      string
 }
 
 func (ac defaultAgentClient) state() (state, error) {
-	state := state{}
-
 	url := fmt.Sprintf(stateEndpointFormat, ac.baseURL)
-	resp, err := http.Get(url)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return state{}, fmt.Errorf("unable to create mesos agent request: %s", err)
+	}
+
+	body, err := ac.do(req)
 	if err != nil {
-		return state, fmt.Errorf("unable connect to mesos agent: %s", err)
+		return state{}, err
 	}
 
+	return parseState(body)
+}
+
+// responseError is returned when Mesos agent responds with unexpected status.
+type responseError struct {
+	statusCode int
+	status     string
+	body       string
+}
+
+func (e *responseError) Error() string {
+	return fmt.Sprintf("mesos agent responded with %s: %s", e.status, e.body)
+}
+
+// do sends authorized request to Mesos agent and returns body of successful
+// response.
+func (ac defaultAgentClient) do(req *http.Request) ([]byte, error) {
+	ac.authorize(req)
+
+	resp, err := ac.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable connect to mesos agent: %s", err)
+	}
+	defer resp.Body.Close()
+
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return state, fmt.Errorf("unable read response from mesos agent: %s", err)
+		return nil, fmt.Errorf("unable read response from mesos agent: %s", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &responseError{statusCode: resp.StatusCode, status: resp.Status, body: strings.TrimSpace(string(body))}
 	}
 
+	return body, nil
+}
+
+func (ac defaultAgentClient) authorize(req *http.Request) {
+	if ac.token != "" {
+		req.Header.Set("Authorization", "Bearer "+ac.token)
+	} else if ac.principal != "" {
+		req.SetBasicAuth(ac.principal, ac.secret)
+	}
+}
+
+func (ac defaultAgentClient) client() *http.Client {
+	if ac.httpClient != nil {
+		return ac.httpClient
+	}
+	return &http.Client{Timeout: defaultAgentTimeout}
+}
+
+func parseState(body []byte) (state, error) {
+	state := state{}
 	if err := json.Unmarshal(body, &state); err != nil {
 		return state, fmt.Errorf("unable to unmarshal mesos agent state response: %s", err)
 	}
@@ -1,9 +1,11 @@
 package mesos
 
 import (
+	"encoding/pem"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -42,3 +44,86 @@ func TestIfReturnsErrorWhenAgentUnavailable(t *testing.T) {
 
 	assert.Error(t, err)
 }
+
+func TestIfReturnsErrorWhenAgentRespondsWithError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	agentClient := defaultAgentClient{
+		baseURL: server.URL,
+	}
+
+	_, err := agentClient.state()
+
+	assert.EqualError(t, err, "mesos agent responded with 401 Unauthorized: ")
+}
+
+func TestIfAuthenticatesInAgent(t *testing.T) {
+	var authorization []string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		authorization = append(authorization, r.Header.Get("Authorization"))
+		rw.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	tokenFile, err := ioutil.TempFile("", "token")
+	require.NoError(t, err)
+	defer os.Remove(tokenFile.Name())
+	_, err = tokenFile.WriteString("jwt\n")
+	require.NoError(t, err)
+	require.NoError(t, tokenFile.Close())
+
+	for _, config := range []AgentConfig{
+		{URL: server.URL, Principal: "principal", Secret: "secret"},
+		{URL: server.URL, Principal: "principal", TokenFile: tokenFile.Name()},
+	} {
+		agentClient, err := config.newClient()
+		require.NoError(t, err)
+
+		_, err = agentClient.state()
+
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{"Basic cHJpbmNpcGFsOnNlY3JldA==", "Bearer jwt"}, authorization)
+}
+
+func TestIfVerifiesAgentCertificateWithCustomCA(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	caFile, err := ioutil.TempFile("", "ca")
+	require.NoError(t, err)
+	defer os.Remove(caFile.Name())
+	require.NoError(t, pem.Encode(caFile, &pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+	require.NoError(t, caFile.Close())
+
+	_, err = defaultAgentClient{baseURL: server.URL}.state()
+	require.Error(t, err)
+
+	agentClient, err := AgentConfig{URL: server.URL, CAFile: caFile.Name()}.newClient()
+	require.NoError(t, err)
+
+	_, err = agentClient.state()
+
+	assert.NoError(t, err)
+}
+
+func TestIfResolvesAgentURLFromEnvironment(t *testing.T) {
+	defer os.Unsetenv("MESOS_AGENT_ENDPOINT")
+	defer os.Unsetenv("LIBPROCESS_IP")
+
+	assert.Equal(t, "http://localhost:5050", AgentConfig{}.baseURL())
+	assert.Equal(t, "https://localhost:5050", AgentConfig{CAFile: "ca.pem"}.baseURL())
+
+	os.Setenv("LIBPROCESS_IP", "192.0.2.2")
+	assert.Equal(t, "http://192.0.2.2:5050", AgentConfig{}.baseURL())
+
+	os.Setenv("MESOS_AGENT_ENDPOINT", "192.0.2.2:5051")
+	assert.Equal(t, "http://192.0.2.2:5051", AgentConfig{}.baseURL())
+	assert.Equal(t, "https://192.0.2.2:5051", AgentConfig{CAFile: "ca.pem"}.baseURL())
+	assert.Equal(t, "https://agent:5051", AgentConfig{URL: "https://agent:5051/"}.baseURL())
+}
@@ -0,0 +1,101 @@
+package mesos
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/allegro/consul-registration-hook/consul"
+)
+
+const (
+	healthCheckHTTP    = "HTTP"
+	healthCheckTCP     = "TCP"
+	healthCheckCommand = "COMMAND"
+
+	// Defaults used by Mesos when health check does not set them.
+	defaultHealthCheckInterval = 10 * time.Second
+	defaultHealthCheckTimeout  = 20 * time.Second
+)
+
+type httpCheck struct {
+	Scheme string
+	Port   int
+	Path   string
+}
+
+type tcpCheck struct {
+	Port int
+}
+
+type healthCheck struct {
+	Type            string
+	IntervalSeconds float64 `json:"interval_seconds"`
+	TimeoutSeconds  float64 `json:"timeout_seconds"`
+	HTTP            *httpCheck
+	TCP             *tcpCheck
+}
+
+// toConsulCheck converts Mesos task health check into Consul check of service
+// registered on the given host and port. Health check port is resolved by
+// Marathon from the port index before task is launched, when it is missing the
+// service port is used.
+func (hc *healthCheck) toConsulCheck(host string, servicePort int) (*consul.Check, error) {
+	check := &consul.Check{
+		Interval: secondsOrDefault(hc.IntervalSeconds, defaultHealthCheckInterval),
+		Timeout:  secondsOrDefault(hc.TimeoutSeconds, defaultHealthCheckTimeout),
+	}
+
+	switch hc.Type {
+	case healthCheckHTTP:
+		if hc.HTTP == nil {
+			return nil, fmt.Errorf("missing http definition of %s health check", hc.Type)
+		}
+		scheme := hc.HTTP.Scheme
+		if scheme == "" {
+			scheme = "http"
+		}
+		address := fmt.Sprintf("%s://%s%s", scheme, hostPort(host, hc.HTTP.Port, servicePort), hc.HTTP.Path)
+		switch scheme {
+		case "http":
+			check.Type = consul.CheckHTTPGet
+			check.Address = address
+		case "https":
+			// Mesos does not verify certificates of HTTPS health checks.
+			check.Type = consul.CheckHTTP
+			check.Method = "GET"
+			check.Address = address
+			check.TLSSkipVerify = true
+		default:
+			return nil, fmt.Errorf("unsupported scheme %q of %s health check", scheme, hc.Type)
+		}
+	case healthCheckTCP:
+		if hc.TCP == nil {
+			return nil, fmt.Errorf("missing tcp definition of %s health check", hc.Type)
+		}
+		check.Type = consul.CheckTCP
+		check.Address = hostPort(host, hc.TCP.Port, servicePort)
+	case healthCheckCommand:
+		// Mesos runs commands inside task container, Consul agent would run
+		// them on its own host.
+		return nil, fmt.Errorf("%s health check runs in task container and cannot be run by Consul agent", hc.Type)
+	default:
+		return nil, fmt.Errorf("unsupported health check type %q", hc.Type)
+	}
+
+	return check, nil
+}
+
+func hostPort(host string, port, defaultPort int) string {
+	if port == 0 {
+		port = defaultPort
+	}
+	return host + ":" + strconv.Itoa(port)
+}
+
+func secondsOrDefault(seconds float64, defaultValue time.Duration) time.Duration {
+	if seconds <= 0 {
+		return defaultValue
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
@@ -0,0 +1,57 @@
+package mesos
+
+import (
+	"testing"
+	"time"
+
+	"github.com/allegro/consul-registration-hook/consul"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIfConvertsHTTPSHealthCheck(t *testing.T) {
+	hc := healthCheck{
+		Type: "HTTP",
+		HTTP: &httpCheck{Scheme: "https", Port: 8443, Path: "/ping"},
+	}
+
+	check, err := hc.toConsulCheck("hostname", 31000)
+
+	require.NoError(t, err)
+	assert.Equal(t, consul.CheckHTTP, check.Type)
+	assert.Equal(t, "GET", check.Method)
+	assert.Equal(t, "https://hostname:8443/ping", check.Address)
+	assert.True(t, check.TLSSkipVerify)
+	assert.Equal(t, defaultHealthCheckInterval, check.Interval)
+	assert.Equal(t, defaultHealthCheckTimeout, check.Timeout)
+}
+
+func TestIfConvertsTCPHealthCheckUsingServicePortWhenMissing(t *testing.T) {
+	hc := healthCheck{
+		Type:            "TCP",
+		IntervalSeconds: 30,
+		TimeoutSeconds:  0.5,
+		TCP:             &tcpCheck{},
+	}
+
+	check, err := hc.toConsulCheck("hostname", 31000)
+
+	require.NoError(t, err)
+	assert.Equal(t, consul.CheckTCP, check.Type)
+	assert.Equal(t, "hostname:31000", check.Address)
+	assert.Equal(t, 30*time.Second, check.Interval)
+	assert.Equal(t, 500*time.Millisecond, check.Timeout)
+}
+
+func TestIfFailsOnUnsupportedHealthCheck(t *testing.T) {
+	for _, hc := range []healthCheck{
+		{Type: "GRPC"},
+		{Type: "HTTP"},
+		{Type: "HTTP", HTTP: &httpCheck{Scheme: "ftp"}},
+		{Type: "COMMAND"},
+	} {
+		_, err := hc.toConsulCheck("hostname", 31000)
+
+		assert.Error(t, err, hc.Type)
+	}
+}
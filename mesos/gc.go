@@ -0,0 +1,61 @@
+package mesos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/allegro/consul-registration-hook/consul"
+)
+
+// terminalTaskStates are states of tasks that will not run anymore.
+var terminalTaskStates = map[string]bool{
+	"TASK_FINISHED": true,
+	"TASK_FAILED":   true,
+	"TASK_KILLED":   true,
+	"TASK_ERROR":    true,
+	"TASK_LOST":     true,
+	"TASK_DROPPED":  true,
+	"TASK_GONE":     true,
+}
+
+// FindOrphans returns services registered for Marathon tasks that no longer
+// run on the agent. Services without Marathon task tag are ignored. It fails
+// when no live tasks are found while services of tasks are registered, as it
+// is more likely a misconfiguration or agent recovery than an idle agent.
+func (p *ServiceProvider) FindOrphans(ctx context.Context, services []consul.ServiceInstance) ([]consul.ServiceInstance, error) {
+	agentClient, err := p.client()
+	if err != nil {
+		return nil, fmt.Errorf("unable to create mesos agent client: %s", err)
+	}
+	state, err := agentClient.state()
+	if err != nil {
+		return nil, fmt.Errorf("agent api error: %s", err)
+	}
+
+	liveTasks := make(map[string]bool)
+	for _, framework := range state.Frameworks {
+		for _, executor := range framework.Executors {
+			for _, task := range executor.Tasks {
+				if !terminalTaskStates[task.State] {
+					liveTasks[task.ID] = true
+				}
+			}
+		}
+	}
+
+	var orphans []consul.ServiceInstance
+	for _, service := range services {
+		taskID, ok := TaskIDFromTags(service.Tags)
+		if !ok {
+			continue
+		}
+		if len(liveTasks) == 0 {
+			return nil, errors.New("no live tasks found on the agent while services of tasks are registered, refusing to reap them")
+		}
+		if !liveTasks[taskID] {
+			orphans = append(orphans, service)
+		}
+	}
+	return orphans, nil
+}
@@ -0,0 +1,62 @@
+package mesos
+
+import (
+	"context"
+	"testing"
+
+	"github.com/allegro/consul-registration-hook/consul"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIfFindsServicesOfTasksNoLongerRunning(t *testing.T) {
+	s := state{Frameworks: []framework{{
+		ID: "framework_id",
+		Executors: []executor{
+			{ID: "running", Tasks: []task{{ID: "running", State: "TASK_RUNNING"}}},
+			{ID: "killed", Tasks: []task{{ID: "killed", State: "TASK_KILLED"}}},
+		},
+	}}}
+	services := []consul.ServiceInstance{
+		{ID: "running", Tags: []string{"marathon-task:running"}},
+		{ID: "killed", Tags: []string{"marathon-task:killed"}},
+		{ID: "gone", Tags: []string{"tag", "marathon-task:gone"}},
+		{ID: "not-marathon", Tags: []string{"tag"}},
+	}
+
+	agentClient := &mockAgentClient{}
+	agentClient.On("state").Return(s, nil)
+	serviceProvider := ServiceProvider{agentClient: agentClient}
+
+	orphans, err := serviceProvider.FindOrphans(context.Background(), services)
+
+	require.NoError(t, err)
+	require.Len(t, orphans, 2)
+	assert.Equal(t, "killed", orphans[0].ID)
+	assert.Equal(t, "gone", orphans[1].ID)
+}
+
+func TestIfRefusesToFindOrphansWhenNoTasksAreLive(t *testing.T) {
+	s := state{Frameworks: []framework{{
+		ID:        "framework_id",
+		Executors: []executor{{ID: "killed", Tasks: []task{{ID: "killed", State: "TASK_KILLED"}}}},
+	}}}
+	services := []consul.ServiceInstance{
+		{ID: "not-marathon", Tags: []string{"tag"}},
+		{ID: "killed", Tags: []string{"marathon-task:killed"}},
+	}
+
+	agentClient := &mockAgentClient{}
+	agentClient.On("state").Return(s, nil)
+	serviceProvider := ServiceProvider{agentClient: agentClient}
+
+	orphans, err := serviceProvider.FindOrphans(context.Background(), services)
+
+	require.Error(t, err)
+	assert.Empty(t, orphans)
+
+	orphans, err = serviceProvider.FindOrphans(context.Background(), services[:1])
+
+	require.NoError(t, err)
+	assert.Empty(t, orphans)
+}
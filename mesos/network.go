@@ -0,0 +1,116 @@
+package mesos
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Network is a networking mode used to determine address of registered services.
+type Network string
+
+const (
+	// NetworkHost registers services with agent hostname and host ports.
+	NetworkHost = Network("host")
+	// NetworkContainer registers services with container IP and container
+	// ports, for tasks on CNI (USER) networks.
+	NetworkContainer = Network("container")
+)
+
+type ipAddress struct {
+	Protocol  string
+	IPAddress string `json:"ip_address"`
+}
+
+type portMapping struct {
+	HostPort      int `json:"host_port"`
+	ContainerPort int `json:"container_port"`
+	Protocol      string
+}
+
+type networkInfo struct {
+	Name         string
+	IPAddresses  []ipAddress   `json:"ip_addresses"`
+	PortMappings []portMapping `json:"port_mappings"`
+}
+
+type containerStatus struct {
+	NetworkInfos []networkInfo `json:"network_infos"`
+}
+
+type taskStatus struct {
+	State           string
+	ContainerStatus containerStatus `json:"container_status"`
+}
+
+type container struct {
+	NetworkInfos []networkInfo `json:"network_infos"`
+}
+
+// taskNetwork is an address services of the task are reachable at.
+type taskNetwork struct {
+	host string
+	// ports maps host ports to container ports.
+	ports map[int]int
+}
+
+// port returns port service is reachable at for the discovery port.
+func (n taskNetwork) port(number int) int {
+	if containerPort, ok := n.ports[number]; ok {
+		return containerPort
+	}
+	return number
+}
+
+func (p *ServiceProvider) getTaskNetwork(t task, hostname string) (taskNetwork, error) {
+	switch p.Network {
+	case NetworkHost, "":
+		return taskNetwork{host: hostname}, nil
+	case NetworkContainer:
+		ip, err := t.containerIP()
+		if err != nil {
+			return taskNetwork{}, err
+		}
+		return taskNetwork{host: ip, ports: t.portMappings()}, nil
+	default:
+		return taskNetwork{}, fmt.Errorf("unsupported network %q", p.Network)
+	}
+}
+
+// containerIP returns container IP reported in the latest task status,
+// preferring IPv4 addresses.
+func (t task) containerIP() (string, error) {
+	for i := len(t.Statuses) - 1; i >= 0; i-- {
+		var ips []ipAddress
+		for _, info := range t.Statuses[i].ContainerStatus.NetworkInfos {
+			ips = append(ips, info.IPAddresses...)
+		}
+		for _, ip := range ips {
+			if ip.Protocol != "IPv6" && ip.IPAddress != "" {
+				return ip.IPAddress, nil
+			}
+		}
+		for _, ip := range ips {
+			if ip.IPAddress != "" {
+				return ip.IPAddress, nil
+			}
+		}
+	}
+	return "", errors.New("no container IP address in task statuses")
+}
+
+// portMappings returns container ports mapped to host ports, both from task
+// container info and reported by the container.
+func (t task) portMappings() map[int]int {
+	infos := t.Container.NetworkInfos
+	for _, status := range t.Statuses {
+		infos = append(infos, status.ContainerStatus.NetworkInfos...)
+	}
+
+	ports := map[int]int{}
+	for _, info := range infos {
+		for _, mapping := range info.PortMappings {
+			ports[mapping.HostPort] = mapping.ContainerPort
+		}
+	}
+	return ports
+}
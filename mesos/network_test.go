@@ -0,0 +1,69 @@
+package mesos
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIfRendersServicesWithContainerNetwork(t *testing.T) {
+	os.Setenv("MESOS_EXECUTOR_ID", "executor_id")
+	os.Setenv("MESOS_FRAMEWORK_ID", "framework_id")
+	os.Setenv("HOST", "hostname")
+	defer os.Unsetenv("MESOS_EXECUTOR_ID")
+	defer os.Unsetenv("MESOS_FRAMEWORK_ID")
+	defer os.Unsetenv("HOST")
+
+	stateJSON, err := ioutil.ReadFile("testdata/state_with_container_network.json")
+	require.NoError(t, err)
+
+	serviceProvider := ServiceProvider{Network: NetworkContainer}
+	serviceInstances, err := serviceProvider.Render(stateJSON)
+
+	require.NoError(t, err)
+	require.Len(t, serviceInstances, 1)
+	assert.Equal(t, "198.51.100.2_8080", serviceInstances[0].ID)
+	assert.Equal(t, "198.51.100.2", serviceInstances[0].Host)
+	assert.Equal(t, 8080, serviceInstances[0].Port)
+
+	serviceProvider = ServiceProvider{}
+	serviceInstances, err = serviceProvider.Render(stateJSON)
+
+	require.NoError(t, err)
+	require.Len(t, serviceInstances, 1)
+	assert.Equal(t, "hostname_31754", serviceInstances[0].ID)
+	assert.Equal(t, "hostname", serviceInstances[0].Host)
+	assert.Equal(t, 31754, serviceInstances[0].Port)
+}
+
+func TestIfReturnsContainerIPFromLatestStatus(t *testing.T) {
+	task := task{Statuses: []taskStatus{
+		{ContainerStatus: containerStatus{NetworkInfos: []networkInfo{{IPAddresses: []ipAddress{{IPAddress: "198.51.100.2"}}}}}},
+		{ContainerStatus: containerStatus{NetworkInfos: []networkInfo{{IPAddresses: []ipAddress{{Protocol: "IPv6", IPAddress: "2001:db8::3"}}}}}},
+		{State: "TASK_RUNNING"},
+	}}
+
+	ip, err := task.containerIP()
+
+	require.NoError(t, err)
+	assert.Equal(t, "2001:db8::3", ip)
+}
+
+func TestIfFailsWithoutContainerIP(t *testing.T) {
+	serviceProvider := ServiceProvider{Network: NetworkContainer}
+
+	_, err := serviceProvider.getTaskNetwork(task{Statuses: []taskStatus{{State: "TASK_RUNNING"}}}, "hostname")
+
+	assert.EqualError(t, err, "no container IP address in task statuses")
+}
+
+func TestIfFailsOnUnsupportedNetwork(t *testing.T) {
+	serviceProvider := ServiceProvider{Network: "bridge"}
+
+	_, err := serviceProvider.getTaskNetwork(task{}, "hostname")
+
+	assert.EqualError(t, err, `unsupported network "bridge"`)
+}
@@ -0,0 +1,123 @@
+package mesos
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+const (
+	operatorEndpointFormat = "%s/api/v1"
+	getTasksCall           = `{"type":"GET_TASKS"}`
+)
+
+type value struct {
+	Value string
+}
+
+type operatorTask struct {
+	TaskID      value `json:"task_id"`
+	FrameworkID value `json:"framework_id"`
+	ExecutorID  value `json:"executor_id"`
+	State       string
+	Labels      labels
+	Discovery   discovery
+	HealthCheck *healthCheck `json:"health_check"`
+	Statuses    []taskStatus
+	Container   container
+}
+
+type getTasksResponse struct {
+	GetTasks struct {
+		LaunchedTasks []operatorTask `json:"launched_tasks"`
+	} `json:"get_tasks"`
+}
+
+// operatorAgentClient reads tasks with v1 operator API, which is lighter than
+// the legacy /state endpoint. Agents not supporting the API are queried with
+// the legacy endpoint.
+type operatorAgentClient struct {
+	defaultAgentClient
+}
+
+func (ac operatorAgentClient) state() (state, error) {
+	url := fmt.Sprintf(operatorEndpointFormat, ac.baseURL)
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBufferString(getTasksCall))
+	if err != nil {
+		return state{}, fmt.Errorf("unable to create mesos agent request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	body, err := ac.do(req)
+	if respErr, ok := err.(*responseError); ok && isUnsupported(respErr.statusCode) {
+		log.Printf("Mesos agent does not support v1 operator API (%s), using legacy state endpoint", respErr.status)
+		return ac.defaultAgentClient.state()
+	}
+	if err != nil {
+		return state{}, err
+	}
+
+	return parseTasks(body)
+}
+
+func isUnsupported(statusCode int) bool {
+	return statusCode == http.StatusNotFound ||
+		statusCode == http.StatusMethodNotAllowed ||
+		statusCode == http.StatusNotImplemented
+}
+
+// parseTasks converts GET_TASKS response into the legacy state structure,
+// grouping launched tasks by framework and executor.
+func parseTasks(body []byte) (state, error) {
+	response := getTasksResponse{}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return state{}, fmt.Errorf("unable to unmarshal mesos agent tasks response: %s", err)
+	}
+
+	s := state{}
+	for _, t := range response.GetTasks.LaunchedTasks {
+		// Tasks run by command executor have no executor ID, the executor is
+		// identified with task ID instead.
+		executorID := t.ExecutorID.Value
+		if executorID == "" {
+			executorID = t.TaskID.Value
+		}
+		e := s.executor(t.FrameworkID.Value, executorID)
+		e.Tasks = append(e.Tasks, task{
+			ID:          t.TaskID.Value,
+			State:       t.State,
+			Labels:      t.Labels.Labels,
+			Discovery:   t.Discovery,
+			HealthCheck: t.HealthCheck,
+			Statuses:    t.Statuses,
+			Container:   t.Container,
+		})
+	}
+
+	return s, nil
+}
+
+// executor returns executor of the framework, adding missing ones to state.
+func (s *state) executor(frameworkID, executorID string) *executor {
+	var f *framework
+	for i := range s.Frameworks {
+		if s.Frameworks[i].ID == frameworkID {
+			f = &s.Frameworks[i]
+		}
+	}
+	if f == nil {
+		s.Frameworks = append(s.Frameworks, framework{ID: frameworkID})
+		f = &s.Frameworks[len(s.Frameworks)-1]
+	}
+
+	for i := range f.Executors {
+		if f.Executors[i].ID == executorID {
+			return &f.Executors[i]
+		}
+	}
+	f.Executors = append(f.Executors, executor{ID: executorID})
+	return &f.Executors[len(f.Executors)-1]
+}
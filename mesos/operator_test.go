@@ -0,0 +1,87 @@
+package mesos
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIfReturnsAgentStateFromOperatorAPI(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v1" || string(body) != `{"type":"GET_TASKS"}` {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		tasks, err := ioutil.ReadFile("testdata/tasks.json")
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		rw.Write(tasks)
+	}))
+	defer server.Close()
+
+	agentClient := operatorAgentClient{defaultAgentClient{baseURL: server.URL}}
+
+	state, err := agentClient.state()
+
+	require.NoError(t, err)
+	require.Len(t, state.Frameworks, 1)
+	require.Len(t, state.Frameworks[0].Executors, 2)
+	assert.Equal(t, "executor_id", state.Frameworks[0].Executors[0].ID)
+	require.Len(t, state.Frameworks[0].Executors[0].Tasks, 1)
+	task := state.Frameworks[0].Executors[0].Tasks[0]
+	assert.Equal(t, "task_id", task.ID)
+	assert.Equal(t, "TASK_RUNNING", task.State)
+	assert.Equal(t, []label{{Key: "consul", Value: "consul-name"}, {Key: "global-tag", Value: "tag"}}, task.Labels)
+	assert.Equal(t, 31754, task.Discovery.Ports.Ports[0].Number)
+	assert.Equal(t, "command_task_id", state.Frameworks[0].Executors[1].ID)
+}
+
+func TestIfFallsBackToStateWhenOperatorAPIIsUnsupported(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/state" {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		state, err := ioutil.ReadFile("testdata/state.json")
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		rw.Write(state)
+	}))
+	defer server.Close()
+
+	agentClient := operatorAgentClient{defaultAgentClient{baseURL: server.URL}}
+
+	state, err := agentClient.state()
+
+	require.NoError(t, err)
+	require.Len(t, state.Frameworks, 1)
+	assert.Equal(t, "task_id", state.Frameworks[0].Executors[0].Tasks[0].ID)
+}
+
+func TestIfDoesNotFallBackToStateOnOperatorAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	agentClient := operatorAgentClient{defaultAgentClient{baseURL: server.URL}}
+
+	_, err := agentClient.state()
+
+	assert.EqualError(t, err, "mesos agent responded with 403 Forbidden: ")
+}
+
+func TestIfFailsOnUnsupportedAgentAPI(t *testing.T) {
+	_, err := AgentConfig{API: "v2"}.newClient()
+
+	assert.EqualError(t, err, `unsupported mesos agent API "v2"`)
+}
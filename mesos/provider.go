@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
 	"os"
 	"strings"
 
@@ -14,29 +15,62 @@ const (
 	consulLabelKey  = "consul"
 	consulTagValue  = "tag"
 	portPlaceholder = "{port:%s}"
+
+	marathonTaskTagPrefix = "marathon-task:"
 )
 
 // ServiceProvider is responsible for providing services that should be registered
 // in Consul discovery service.
 type ServiceProvider struct {
+	Agent AgentConfig
+	// Network determines address services are registered with, defaults to
+	// NetworkHost.
+	Network Network
+
 	agentClient agentClient
 }
 
 // Get returns slice of services that are configured to be registered in Consul
 // discovery service.
 func (p *ServiceProvider) Get(ctx context.Context) ([]consul.ServiceInstance, error) {
-	agentClient := p.client()
+	agentClient, err := p.client()
+	if err != nil {
+		return nil, fmt.Errorf("unable to create mesos agent client: %s", err)
+	}
 	state, err := agentClient.state()
 	if err != nil {
 		return nil, fmt.Errorf("agent api error: %s", err)
 	}
 
-	task, err := p.getTaskFromState(state)
+	return p.servicesFromState(state)
+}
+
+// Render returns slice of services that would be registered for the task
+// found in passed agent state JSON, without contacting Mesos agent.
+func (p *ServiceProvider) Render(stateJSON []byte) ([]consul.ServiceInstance, error) {
+	state, err := parseState(stateJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.servicesFromState(state)
+}
+
+func (p *ServiceProvider) servicesFromState(state state) ([]consul.ServiceInstance, error) {
+	tasks, err := p.getTasksFromState(state)
 	if err != nil {
 		return nil, fmt.Errorf("unable to find task info: %s", err)
 	}
 
-	return p.buildServices(task)
+	var services []consul.ServiceInstance
+	for _, task := range tasks {
+		taskServices, err := p.buildServices(task)
+		if err != nil {
+			return nil, err
+		}
+		services = append(services, taskServices...)
+	}
+	return services, nil
 }
 
 func (p *ServiceProvider) buildServices(t task) ([]consul.ServiceInstance, error) {
@@ -44,6 +78,10 @@ func (p *ServiceProvider) buildServices(t task) ([]consul.ServiceInstance, error
 	if err != nil {
 		return nil, fmt.Errorf("unable to determine hostname: %s", err)
 	}
+	network, err := p.getTaskNetwork(t, hostname)
+	if err != nil {
+		return nil, fmt.Errorf("unable to determine task address: %s", err)
+	}
 
 	var services []consul.ServiceInstance
 	var globalTags []string
@@ -54,21 +92,19 @@ func (p *ServiceProvider) buildServices(t task) ([]consul.ServiceInstance, error
 		}
 	}
 
-	marathonTaskTag := fmt.Sprintf("marathon-task:%s", t.ID)
-	globalTags = append(globalTags, marathonTaskTag)
+	globalTags = append(globalTags, MarathonTaskTag(t.ID))
 	tagPlaceholders := getPlaceholders(t.Discovery.Ports.Ports)
 
-	// TODO(medzin): add check conversion after MESOS-8780 is completed
-	// See: https://issues.apache.org/jira/browse/MESOS-8780
 	for _, port := range t.Discovery.Ports.Ports {
 		if consulServiceName := p.getConsulServiceName(port.Labels.Labels); consulServiceName != "" {
 			portTags := p.getPortLabels(port.Labels.Labels, tagPlaceholders)
 
+			servicePort := network.port(port.Number)
 			service := consul.ServiceInstance{
-				ID:   fmt.Sprintf("%s_%d", hostname, port.Number),
+				ID:   fmt.Sprintf("%s_%d", network.host, servicePort),
 				Name: consulServiceName,
-				Host: hostname,
-				Port: port.Number,
+				Host: network.host,
+				Port: servicePort,
 				Tags: append(portTags, globalTags...),
 			}
 			services = append(services, service)
@@ -77,11 +113,11 @@ func (p *ServiceProvider) buildServices(t task) ([]consul.ServiceInstance, error
 
 	if len(services) == 0 && len(t.Discovery.Ports.Ports) > 0 {
 		if consulServiceName := p.getConsulServiceName(t.Labels); consulServiceName != "" {
-			port := t.Discovery.Ports.Ports[0].Number
+			port := network.port(t.Discovery.Ports.Ports[0].Number)
 			service := consul.ServiceInstance{
-				ID:   fmt.Sprintf("%s_%d", hostname, port),
+				ID:   fmt.Sprintf("%s_%d", network.host, port),
 				Name: consulServiceName,
-				Host: hostname,
+				Host: network.host,
 				Port: port,
 				Tags: globalTags,
 			}
@@ -89,6 +125,17 @@ func (p *ServiceProvider) buildServices(t task) ([]consul.ServiceInstance, error
 		}
 	}
 
+	if t.HealthCheck != nil {
+		for i := range services {
+			check, err := t.HealthCheck.toConsulCheck(services[i].Host, services[i].Port)
+			if err != nil {
+				log.Printf("Registering service %s of task %s without check: %s", services[i].ID, t.ID, err)
+				continue
+			}
+			services[i].Check = check
+		}
+	}
+
 	return services, nil
 }
 
@@ -105,11 +152,11 @@ func (p *ServiceProvider) getPortLabels(labels []label, tagPlaceholders map[stri
 	return portLabels
 }
 
-func (p *ServiceProvider) client() agentClient {
+func (p *ServiceProvider) client() (agentClient, error) {
 	if p.agentClient != nil {
-		return p.agentClient
+		return p.agentClient, nil
 	}
-	return defaultAgentClient{baseURL: defaultAgentBaseURL}
+	return p.Agent.newClient()
 }
 
 func (p *ServiceProvider) getConsulServiceName(labels []label) string {
@@ -138,25 +185,38 @@ func (p *ServiceProvider) getMesosHostname() (string, error) {
 	return hostname, nil
 }
 
-func (p *ServiceProvider) getTaskFromState(state state) (task, error) {
+// getTasksFromState returns tasks run by the executor. Executors of task groups
+// (Marathon pods) run multiple tasks, when MESOS_TASK_ID is set only the task
+// it identifies is returned.
+func (p *ServiceProvider) getTasksFromState(state state) ([]task, error) {
 	executorID, frameworkID, err := p.getExecutorAndFrameworkID()
 	if err != nil {
-		return task{}, fmt.Errorf("not enough data to search for task info: %s", err)
+		return nil, fmt.Errorf("not enough data to search for task info: %s", err)
 	}
+	taskID := os.Getenv("MESOS_TASK_ID")
 
 	for _, framework := range state.Frameworks {
 		if framework.ID == frameworkID {
 			for _, executor := range framework.Executors {
 				if executor.ID == executorID {
-					if len(executor.Tasks) > 0 {
-						return executor.Tasks[0], nil
+					if len(executor.Tasks) == 0 {
+						break
+					}
+					if taskID == "" {
+						return executor.Tasks, nil
 					}
+					for i := range executor.Tasks {
+						if executor.Tasks[i].ID == taskID {
+							return executor.Tasks[i : i+1], nil
+						}
+					}
+					return nil, fmt.Errorf("no task %q in executor", taskID)
 				}
 			}
 		}
 	}
 
-	return task{}, errors.New("no task in executor")
+	return nil, errors.New("no task in executor")
 }
 
 func getPlaceholders(ports []port) map[string]string {
@@ -170,3 +230,19 @@ func getPlaceholders(ports []port) map[string]string {
 	}
 	return placeholders
 }
+
+// MarathonTaskTag returns tag identifying services registered for the given
+// Marathon task.
+func MarathonTaskTag(taskID string) string {
+	return marathonTaskTagPrefix + taskID
+}
+
+// TaskIDFromTags returns ID of the Marathon task carried by service tags.
+func TaskIDFromTags(tags []string) (string, bool) {
+	for _, tag := range tags {
+		if strings.HasPrefix(tag, marathonTaskTagPrefix) {
+			return strings.TrimPrefix(tag, marathonTaskTagPrefix), true
+		}
+	}
+	return "", false
+}
@@ -2,8 +2,12 @@ package mesos
 
 import (
 	"context"
+	"io/ioutil"
 	"os"
 	"testing"
+	"time"
+
+	"github.com/allegro/consul-registration-hook/consul"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -273,6 +277,119 @@ func TestIfConvertsMesosLabelsToConsulTags(t *testing.T) {
 	assert.Equal(t, []string{"tag1", "tag2", "marathon-task:executor_id_inside_task"}, serviceInstances[0].Tags)
 }
 
+func TestIfRendersServicesFromStateFile(t *testing.T) {
+	os.Setenv("MESOS_EXECUTOR_ID", "executor_id")
+	os.Setenv("MESOS_FRAMEWORK_ID", "framework_id")
+	os.Setenv("HOST", "hostname")
+	defer os.Unsetenv("MESOS_EXECUTOR_ID")
+	defer os.Unsetenv("MESOS_FRAMEWORK_ID")
+	defer os.Unsetenv("HOST")
+
+	stateJSON, err := ioutil.ReadFile("testdata/state_with_discovery.json")
+	require.NoError(t, err)
+
+	serviceProvider := ServiceProvider{}
+	serviceInstances, err := serviceProvider.Render(stateJSON)
+
+	require.NoError(t, err)
+	require.Len(t, serviceInstances, 1)
+	assert.Equal(t, "hostname_31754", serviceInstances[0].ID)
+	assert.Equal(t, "consul-name", serviceInstances[0].Name)
+	assert.Equal(t, []string{"port-tag", "global-tag", "marathon-task:task_id"}, serviceInstances[0].Tags)
+}
+
+func TestIfRendersServicesWithHealthCheckFromStateFile(t *testing.T) {
+	os.Setenv("MESOS_EXECUTOR_ID", "executor_id")
+	os.Setenv("MESOS_FRAMEWORK_ID", "framework_id")
+	os.Setenv("HOST", "hostname")
+	defer os.Unsetenv("MESOS_EXECUTOR_ID")
+	defer os.Unsetenv("MESOS_FRAMEWORK_ID")
+	defer os.Unsetenv("HOST")
+
+	stateJSON, err := ioutil.ReadFile("testdata/state_with_health_check.json")
+	require.NoError(t, err)
+
+	serviceProvider := ServiceProvider{}
+	serviceInstances, err := serviceProvider.Render(stateJSON)
+
+	require.NoError(t, err)
+	require.Len(t, serviceInstances, 1)
+	require.NotNil(t, serviceInstances[0].Check)
+	assert.Equal(t, consul.CheckHTTPGet, serviceInstances[0].Check.Type)
+	assert.Equal(t, "http://hostname:31754/status/ping", serviceInstances[0].Check.Address)
+	assert.Equal(t, 5*time.Second, serviceInstances[0].Check.Interval)
+	assert.Equal(t, 2*time.Second, serviceInstances[0].Check.Timeout)
+}
+
+func TestIfRendersServicesWithoutUnsupportedHealthCheck(t *testing.T) {
+	os.Setenv("MESOS_EXECUTOR_ID", "executor_id")
+	os.Setenv("MESOS_FRAMEWORK_ID", "framework_id")
+	os.Setenv("HOST", "hostname")
+	defer os.Unsetenv("MESOS_EXECUTOR_ID")
+	defer os.Unsetenv("MESOS_FRAMEWORK_ID")
+	defer os.Unsetenv("HOST")
+
+	stateJSON, err := ioutil.ReadFile("testdata/state_with_command_health_check.json")
+	require.NoError(t, err)
+
+	serviceProvider := ServiceProvider{}
+	serviceInstances, err := serviceProvider.Render(stateJSON)
+
+	require.NoError(t, err)
+	require.Len(t, serviceInstances, 1)
+	assert.Equal(t, "hostname_31754", serviceInstances[0].ID)
+	assert.Nil(t, serviceInstances[0].Check)
+}
+
+func TestIfReturnsServicesOfAllTasksInTaskGroup(t *testing.T) {
+	os.Setenv("MESOS_EXECUTOR_ID", "instance-pod.marathon-1234")
+	os.Setenv("MESOS_FRAMEWORK_ID", "framework_id")
+	os.Setenv("HOST", "hostname")
+	defer os.Unsetenv("MESOS_EXECUTOR_ID")
+	defer os.Unsetenv("MESOS_FRAMEWORK_ID")
+	defer os.Unsetenv("HOST")
+
+	stateJSON, err := ioutil.ReadFile("testdata/state_with_task_group.json")
+	require.NoError(t, err)
+
+	serviceProvider := ServiceProvider{}
+	serviceInstances, err := serviceProvider.Render(stateJSON)
+
+	require.NoError(t, err)
+	require.Len(t, serviceInstances, 2)
+	assert.Equal(t, "consul-name", serviceInstances[0].Name)
+	assert.Equal(t, []string{"port-tag", "global-tag", "marathon-task:pod.instance-1234.web"}, serviceInstances[0].Tags)
+	assert.Equal(t, "hostname_31755", serviceInstances[1].ID)
+	assert.Equal(t, "consul-admin", serviceInstances[1].Name)
+	assert.Equal(t, []string{"port-tag", "global-tag", "marathon-task:pod.instance-1234.admin"}, serviceInstances[1].Tags)
+}
+
+func TestIfReturnsServicesOfTaskFromEnvironmentInTaskGroup(t *testing.T) {
+	os.Setenv("MESOS_EXECUTOR_ID", "instance-pod.marathon-1234")
+	os.Setenv("MESOS_FRAMEWORK_ID", "framework_id")
+	os.Setenv("HOST", "hostname")
+	defer os.Unsetenv("MESOS_EXECUTOR_ID")
+	defer os.Unsetenv("MESOS_FRAMEWORK_ID")
+	defer os.Unsetenv("HOST")
+	defer os.Unsetenv("MESOS_TASK_ID")
+
+	stateJSON, err := ioutil.ReadFile("testdata/state_with_task_group.json")
+	require.NoError(t, err)
+	serviceProvider := ServiceProvider{}
+
+	os.Setenv("MESOS_TASK_ID", "pod.instance-1234.admin")
+	serviceInstances, err := serviceProvider.Render(stateJSON)
+
+	require.NoError(t, err)
+	require.Len(t, serviceInstances, 1)
+	assert.Equal(t, "consul-admin", serviceInstances[0].Name)
+
+	os.Setenv("MESOS_TASK_ID", "pod.instance-1234.unknown")
+	_, err = serviceProvider.Render(stateJSON)
+
+	assert.EqualError(t, err, `unable to find task info: no task "pod.instance-1234.unknown" in executor`)
+}
+
 type mockAgentClient struct {
 	mock.Mock
 }